@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -14,19 +15,31 @@ import (
 )
 
 type config struct {
-	endpoint                     string
-	nodeName                     string
-	infraClusterNamespace        string
-	infraClusterKubeconfig       string
-	infraClusterLabels           string
-	volumePrefix                 string
-	infraStorageClassEnforcement string
+	endpoint                      string
+	nodeName                      string
+	infraClusterNamespace         string
+	infraClusterKubeconfig        string
+	infraClusterLabels            string
+	infraClusterAllowedNamespaces string
+	enforceVMOwnership            bool
+	vmOwnershipAnnotation         string
+	volumePrefix                  string
+	infraStorageClassEnforcement  string
 
 	tenantClusterKubeconfig string
 
 	runNodeService       bool
 	runControllerService bool
 
+	hotplugTimeout       time.Duration
+	snapshotTimeout      time.Duration
+	expandTimeout        time.Duration
+	hotplugRetrySteps    int
+	hotplugRetryInterval time.Duration
+	maxVolumesPerNode    int64
+	fstrimInterval       time.Duration
+	metricsAddress       string
+
 	// Client section.
 	tenantConfig            *rest.Config
 	infraConfig             *rest.Config
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 
@@ -32,6 +33,10 @@ func main() {
 		klog.Fatalf("Failed to initialize driver: %s", err)
 	}
 
+	if cfg.runNodeService {
+		startNodeTasks(cfg, driver)
+	}
+
 	driver.Run(cfg.endpoint)
 	os.Exit(0)
 }
@@ -48,6 +53,9 @@ func parseConfig(args []string) (*config, error) {
 	fs.StringVar(&cfg.infraClusterNamespace, "infra-cluster-namespace", "", "The infra-cluster namespace")
 	fs.StringVar(&cfg.infraClusterKubeconfig, "infra-cluster-kubeconfig", "", "the infra-cluster kubeconfig file. If not set, defaults to in cluster config.")
 	fs.StringVar(&cfg.infraClusterLabels, "infra-cluster-labels", "", "The infra-cluster labels to use when creating resources in infra cluster. 'name=value' fields separated by a comma")
+	fs.StringVar(&cfg.infraClusterAllowedNamespaces, "infra-cluster-allowed-namespaces", "", "Infra-cluster namespaces besides infra-cluster-namespace whose VMs volumes can be attached to, separated by a comma")
+	fs.BoolVar(&cfg.enforceVMOwnership, "enforce-vm-ownership", true, "Only attach volumes to infra VMs that carry the infra-cluster-labels or the infra-vm-ownership-annotation")
+	fs.StringVar(&cfg.vmOwnershipAnnotation, "infra-vm-ownership-annotation", "", "An annotation in 'name=value' format that marks the infra VMs of this tenant cluster besides the infra-cluster-labels")
 	fs.StringVar(&cfg.volumePrefix, "volume-prefix", "pvc", "The prefix expected for persistent volumes")
 
 	fs.StringVar(&cfg.tenantClusterKubeconfig, "tenant-cluster-kubeconfig", "", "the tenant cluster kubeconfig file. If not set, defaults to in cluster config.")
@@ -55,6 +63,15 @@ func parseConfig(args []string) (*config, error) {
 	fs.BoolVar(&cfg.runNodeService, "run-node-service", true, "Specifies whether or not to run the node service, the default is true")
 	fs.BoolVar(&cfg.runControllerService, "run-controller-service", true, "Specifies whether or not to run the controller service, the default is true")
 
+	fs.DurationVar(&cfg.hotplugTimeout, "hotplug-timeout", service.DefaultHotplugTimeout, "How long to wait for a volume to be hotplugged into or unplugged from the infra VM. Keep it below the csi-attacher --timeout")
+	fs.DurationVar(&cfg.snapshotTimeout, "snapshot-timeout", service.DefaultSnapshotTimeout, "How long to wait for an infra volume snapshot to become ready. Keep it below the csi-snapshotter --timeout")
+	fs.DurationVar(&cfg.expandTimeout, "expand-timeout", service.DefaultExpandTimeout, "How long to wait for an infra volume to be resized. Keep it below the csi-resizer --timeout")
+	fs.IntVar(&cfg.hotplugRetrySteps, "hotplug-retry-steps", service.DefaultHotplugRetrySteps, "How many times to try adding or removing a volume on the infra VM")
+	fs.Int64Var(&cfg.maxVolumesPerNode, "max-volumes-per-node", 0, "How many volumes can be hotplugged into a node. If not set, the controller enforces the limit of the disk bus of each volume and the node reports the smallest limit of the buses")
+	fs.DurationVar(&cfg.hotplugRetryInterval, "hotplug-retry-interval", service.DefaultHotplugRetryInterval, "The initial interval between hotplug attempts, doubled after every attempt")
+	fs.DurationVar(&cfg.fstrimInterval, "fstrim-interval", service.DefaultFstrimInterval, "How often the node trims the filesystems of volumes with the fstrim discard mode, 0 disables trimming")
+	fs.StringVar(&cfg.metricsAddress, "metrics-address", "", "The address the node service serves its metrics on, e.g. :8080. If not set, metrics are not served")
+
 	if err := fs.Parse(args); err != nil {
 		return nil, err
 	}
@@ -64,6 +81,22 @@ func parseConfig(args []string) (*config, error) {
 	return cfg, nil
 }
 
+// startNodeTasks starts the work the node service does besides answering CSI calls.
+func startNodeTasks(cfg *config, driver *service.KubevirtCSIDriver) {
+	if cfg.fstrimInterval > 0 {
+		go driver.NodeService.RunFstrim(context.Background(), cfg.fstrimInterval)
+	}
+	if cfg.metricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", driver.NodeService.MetricsHandler())
+		go func() {
+			if err := http.ListenAndServe(cfg.metricsAddress, mux); err != nil {
+				klog.Errorf("Failed to serve metrics on %s: %v", cfg.metricsAddress, err)
+			}
+		}()
+	}
+}
+
 // prechecks performs validation checks on the configuration provided.
 func prechecks() error {
 	if service.VendorVersion == "" {
@@ -111,6 +144,11 @@ func configureControllerService(cfg *config, driver *service.KubevirtCSIDriver)
 		return nil, fmt.Errorf("failed to configure storage class enforcement: %w", err)
 	}
 
+	vmOwnership, err := parseVMOwnership(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	identityClientset, err := cfg.getInfraClientset()
 	if err != nil {
 		return nil, err
@@ -120,6 +158,11 @@ func configureControllerService(cfg *config, driver *service.KubevirtCSIDriver)
 	if err != nil {
 		return nil, err
 	}
+	// Serve reads of the infra objects from informers. Startup doesn't wait for them, reads go to the API server until
+	// they have synced, and for resources the driver may not list or that don't exist in the infra cluster.
+	if err := virtClient.StartInformers(context.Background(), cfg.infraClusterNamespace); err != nil {
+		return nil, fmt.Errorf("failed to start infra cluster informers: %w", err)
+	}
 
 	return driver.
 		WithControllerService(
@@ -127,6 +170,16 @@ func configureControllerService(cfg *config, driver *service.KubevirtCSIDriver)
 			cfg.infraClusterNamespace,
 			infraClusterLabelsMap,
 			storageClassEnforcement,
+			parseAllowedNamespaces(cfg),
+			vmOwnership,
+			service.ControllerTimeouts{
+				Hotplug:              cfg.hotplugTimeout,
+				Snapshot:             cfg.snapshotTimeout,
+				Expand:               cfg.expandTimeout,
+				HotplugRetrySteps:    cfg.hotplugRetrySteps,
+				HotplugRetryInterval: cfg.hotplugRetryInterval,
+			},
+			cfg.maxVolumesPerNode,
 		).
 		WithIdentityService(
 			identityClientset,
@@ -159,6 +212,8 @@ func configureNodeService(cfg *config, driver *service.KubevirtCSIDriver) (*serv
 	return driver.
 		WithNodeService(
 			nodeID,
+			cfg.maxVolumesPerNode,
+			service.NewVolumeEventRecorder(tenantClientset, cfg.nodeName),
 		).
 		WithIdentityService(
 			tenantClientset,
@@ -201,6 +256,31 @@ func parseLabels(cfg *config) (map[string]string, error) {
 	return infraClusterLabelsMap, nil
 }
 
+// parseAllowedNamespaces returns the namespaces of infra-cluster-allowed-namespaces.
+func parseAllowedNamespaces(cfg *config) []string {
+	var namespaces []string
+	for _, namespace := range strings.Split(cfg.infraClusterAllowedNamespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// parseVMOwnership returns how the infra VMs of this tenant cluster are recognised.
+func parseVMOwnership(cfg *config) (service.VMOwnership, error) {
+	ownership := service.VMOwnership{Enforce: cfg.enforceVMOwnership}
+	if cfg.vmOwnershipAnnotation == "" {
+		return ownership, nil
+	}
+	annotation := strings.SplitN(cfg.vmOwnershipAnnotation, "=", 2)
+	if len(annotation) != 2 || annotation[0] == "" {
+		return ownership, errors.New("bad infra-vm-ownership-annotation format. Should be 'key=value'")
+	}
+	ownership.AnnotationKey, ownership.AnnotationValue = annotation[0], annotation[1]
+	return ownership, nil
+}
+
 // resolveNodeID resolves the infra cluster VM name and namespace from the node's providerID or annotations.
 // It returns the nodeID in the format "namespace/name" or an error if resolution fails.
 func resolveNodeID(providerID string, annotations map[string]string) (string, error) {
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"reflect"
 	"testing"
+
+	"kubevirt.io/csi-driver/pkg/service"
 )
 
 func TestResolveNodeID(t *testing.T) {
@@ -140,6 +143,76 @@ func TestResolveNodeID(t *testing.T) {
 	}
 }
 
+func TestParseAllowedNamespaces(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces string
+		want       []string
+	}{
+		{
+			name:       "not set",
+			namespaces: "",
+			want:       nil,
+		},
+		{
+			name:       "single namespace",
+			namespaces: "tenant-a",
+			want:       []string{"tenant-a"},
+		},
+		{
+			name:       "spaces and empty entries",
+			namespaces: "tenant-a, tenant-b,,",
+			want:       []string{"tenant-a", "tenant-b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseAllowedNamespaces(&config{infraClusterAllowedNamespaces: tt.namespaces})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAllowedNamespaces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVMOwnership(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		want       service.VMOwnership
+		wantErr    bool
+	}{
+		{
+			name: "labels only",
+			want: service.VMOwnership{Enforce: true},
+		},
+		{
+			name:       "annotation",
+			annotation: "example.com/tenant=cluster-a",
+			want:       service.VMOwnership{Enforce: true, AnnotationKey: "example.com/tenant", AnnotationValue: "cluster-a"},
+		},
+		{
+			name:       "missing value",
+			annotation: "example.com/tenant",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseVMOwnership(&config{enforceVMOwnership: true, vmOwnershipAnnotation: tt.annotation})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseVMOwnership() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseVMOwnership() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func contains(s, substr string) bool {
 	for i := 0; i <= len(s)-len(substr); i++ {
 		if s[i:i+len(substr)] == substr {
@@ -0,0 +1,216 @@
+package kubevirt
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
+)
+
+// vmiVolumeIndex indexes VMIs by the names of the volumes in their status.
+const vmiVolumeIndex = "volumeName"
+
+// infraCache holds informers for the objects the driver reads in the infra cluster namespace. DataVolumes, PVCs and
+// VolumeSnapshots are filtered by the infra cluster labels, VMs and VMIs are not labeled by the driver so all of the
+// namespace is cached. Reads are served from the cache, writes always go to the API server.
+type infraCache struct {
+	namespace   string
+	vmis        *cachedInformer
+	vms         *cachedInformer
+	dataVolumes *cachedInformer
+	pvcs        *cachedInformer
+	snapshots   *cachedInformer
+	// started is closed once the informers that can run have been started.
+	started chan struct{}
+}
+
+// cachedInformer is an informer of the infra cache. It only runs when the driver may list and watch its resource,
+// and only serves reads once it has synced.
+type cachedInformer struct {
+	resource string
+	informer cache.SharedIndexInformer
+	list     cache.ListFunc
+	running  atomic.Bool
+}
+
+func newCachedInformer(resource string, lw *cache.ListWatch, objType runtime.Object, indexers cache.Indexers) *cachedInformer {
+	return &cachedInformer{
+		resource: resource,
+		informer: cache.NewSharedIndexInformer(lw, objType, 0, indexers),
+		list:     lw.ListFunc,
+	}
+}
+
+// serving returns the informer when it serves reads, nil when they go to the API server.
+func (ci *cachedInformer) serving() cache.SharedIndexInformer {
+	if !ci.running.Load() || !ci.informer.HasSynced() {
+		return nil
+	}
+	return ci.informer
+}
+
+func newInfraCache(c *client, namespace string) (*infraCache, error) {
+	selector, err := labels.ValidatedSelectorFromSet(c.infraLabelMap)
+	if err != nil {
+		return nil, err
+	}
+	withLabels := func(opts metav1.ListOptions) metav1.ListOptions {
+		opts.LabelSelector = selector.String()
+		return opts
+	}
+	ctx := context.Background()
+	namespaceIndexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+
+	vmis := c.virtClient.KubevirtV1().VirtualMachineInstances(namespace)
+	vms := c.virtClient.KubevirtV1().VirtualMachines(namespace)
+	dataVolumes := c.cdiClient.CdiV1beta1().DataVolumes(namespace)
+	pvcs := c.infraKubernetesClient.CoreV1().PersistentVolumeClaims(namespace)
+	snapshots := c.infraSnapClient.SnapshotV1().VolumeSnapshots(namespace)
+
+	ic := &infraCache{namespace: namespace, started: make(chan struct{})}
+	ic.vmis = newCachedInformer("virtualmachineinstances", &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return vmis.List(ctx, opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return vmis.Watch(ctx, opts)
+		},
+	}, &kubevirtv1.VirtualMachineInstance{}, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+		vmiVolumeIndex:       vmiVolumeNames,
+	})
+	ic.vms = newCachedInformer("virtualmachines", &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return vms.List(ctx, opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return vms.Watch(ctx, opts)
+		},
+	}, &kubevirtv1.VirtualMachine{}, namespaceIndexers)
+	ic.dataVolumes = newCachedInformer("datavolumes", &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return dataVolumes.List(ctx, withLabels(opts))
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return dataVolumes.Watch(ctx, withLabels(opts))
+		},
+	}, &cdiv1.DataVolume{}, namespaceIndexers)
+	ic.pvcs = newCachedInformer("persistentvolumeclaims", &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return pvcs.List(ctx, withLabels(opts))
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return pvcs.Watch(ctx, withLabels(opts))
+		},
+	}, &k8sv1.PersistentVolumeClaim{}, namespaceIndexers)
+	ic.snapshots = newCachedInformer("volumesnapshots", &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return snapshots.List(ctx, withLabels(opts))
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return snapshots.Watch(ctx, withLabels(opts))
+		},
+	}, &snapshotv1.VolumeSnapshot{}, namespaceIndexers)
+	return ic, nil
+}
+
+func (ic *infraCache) informers() []*cachedInformer {
+	return []*cachedInformer{ic.vmis, ic.vms, ic.dataVolumes, ic.pvcs, ic.snapshots}
+}
+
+// start runs the informers until ctx is done and logs once they have synced. Resources that don't exist in the infra
+// cluster, like VolumeSnapshots without the snapshot CRDs, or that the driver may not list, aren't cached, their reads
+// go to the API server. So do the reads of the other resources until their informer has synced.
+func (ic *infraCache) start(ctx context.Context) {
+	var hasSynced []cache.InformerSynced
+	for _, ci := range ic.informers() {
+		if _, err := ci.list(metav1.ListOptions{Limit: 1}); errors.IsNotFound(err) || errors.IsForbidden(err) || meta.IsNoMatchError(err) {
+			klog.Warningf("Not caching %s in namespace %s, reading them from the API server: %v", ci.resource, ic.namespace, err)
+			continue
+		}
+		go ci.informer.Run(ctx.Done())
+		ci.running.Store(true)
+		hasSynced = append(hasSynced, ci.informer.HasSynced)
+	}
+	close(ic.started)
+	if cache.WaitForCacheSync(ctx.Done(), hasSynced...) {
+		klog.V(3).Infof("Informers in namespace %s synced", ic.namespace)
+	}
+}
+
+type liveReadsKey struct{}
+
+// WithLiveReads returns a context whose reads go to the API server instead of the informers, for decisions that can't
+// be made on a cached copy that may lag behind.
+func WithLiveReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, liveReadsKey{}, true)
+}
+
+// informer returns the informer of resource when it serves reads in namespace, nil when they go to the API server.
+func (ic *infraCache) informer(ctx context.Context, namespace string, resource func(*infraCache) *cachedInformer) cache.SharedIndexInformer {
+	if ic == nil || ic.namespace != namespace || ctx.Value(liveReadsKey{}) != nil {
+		return nil
+	}
+	return resource(ic).serving()
+}
+
+func vmiInformer(ic *infraCache) *cachedInformer        { return ic.vmis }
+func vmInformer(ic *infraCache) *cachedInformer         { return ic.vms }
+func dataVolumeInformer(ic *infraCache) *cachedInformer { return ic.dataVolumes }
+func pvcInformer(ic *infraCache) *cachedInformer        { return ic.pvcs }
+func snapshotInformer(ic *infraCache) *cachedInformer   { return ic.snapshots }
+
+func vmiVolumeNames(obj interface{}) ([]string, error) {
+	vmi, ok := obj.(*kubevirtv1.VirtualMachineInstance)
+	if !ok {
+		return nil, nil
+	}
+	var names []string
+	for _, volumeStatus := range vmi.Status.VolumeStatus {
+		names = append(names, volumeStatus.Name)
+	}
+	return names, nil
+}
+
+// getCached returns a copy of the object namespace/name from the informer, and whether it was found.
+func getCached[T runtime.Object](informer cache.SharedIndexInformer, namespace, name string) (T, bool, error) {
+	var result T
+	obj, exists, err := informer.GetIndexer().GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return result, false, err
+	}
+	typed, ok := obj.(T)
+	if !ok {
+		return result, false, fmt.Errorf("unexpected object %T in cache", obj)
+	}
+	return typed.DeepCopyObject().(T), true, nil
+}
+
+// listCached returns copies of the objects in the informer matching indexName/indexValue.
+func listCached[T runtime.Object](informer cache.SharedIndexInformer, indexName, indexValue string) ([]T, error) {
+	objs, err := informer.GetIndexer().ByIndex(indexName, indexValue)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]T, 0, len(objs))
+	for _, obj := range objs {
+		typed, ok := obj.(T)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object %T in cache", obj)
+		}
+		result = append(result, typed.DeepCopyObject().(T))
+	}
+	return result, nil
+}
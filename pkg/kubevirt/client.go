@@ -18,9 +18,9 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
@@ -32,6 +32,7 @@ import (
 
 const (
 	vmSubresourceURL                = "/apis/subresources.kubevirt.io/%s/namespaces/%s/virtualmachines/%s/%s"
+	vmiSubresourceURL               = "/apis/subresources.kubevirt.io/%s/namespaces/%s/virtualmachineinstances/%s/%s"
 	annDefaultSnapshotClass         = "snapshot.storage.kubernetes.io/is-default-class"
 	InfraStorageClassNameParameter  = "infraStorageClassName"
 	InfraSnapshotClassNameParameter = "infraSnapshotClassName"
@@ -55,9 +56,12 @@ type ClientBuilderFuncType func(kubeconfig string) (Client, error)
 // Client is a wrapper object for actual infra-cluster clients: kubernetes and the kubevirt
 type Client interface {
 	Ping(ctx context.Context) error
+	StartInformers(ctx context.Context, namespace string) error
 	ListVirtualMachines(ctx context.Context, namespace string) ([]kubevirtv1.VirtualMachineInstance, error)
+	ListVirtualMachinesWithVolume(ctx context.Context, namespace, volumeName string) ([]kubevirtv1.VirtualMachineInstance, error)
 	GetVirtualMachine(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachineInstance, error)
 	GetWorkloadManagingVirtualMachine(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachine, error)
+	GetActiveMigration(ctx context.Context, namespace, vmiName string) (*kubevirtv1.VirtualMachineInstanceMigration, error)
 	DeleteDataVolume(ctx context.Context, namespace string, name string) error
 	CreateDataVolume(ctx context.Context, namespace string, dataVolume *cdiv1.DataVolume) (*cdiv1.DataVolume, error)
 	GetDataVolume(ctx context.Context, namespace string, name string) (*cdiv1.DataVolume, error)
@@ -65,6 +69,7 @@ type Client interface {
 	ExpandPersistentVolumeClaim(ctx context.Context, namespace string, claimName string, size int64) error
 	AddVolumeToVM(ctx context.Context, namespace string, vmName string, hotPlugRequest *kubevirtv1.AddVolumeOptions) error
 	RemoveVolumeFromVM(ctx context.Context, namespace string, vmName string, hotPlugRequest *kubevirtv1.RemoveVolumeOptions) error
+	AddVolumeToVMI(ctx context.Context, namespace string, vmiName string, hotPlugRequest *kubevirtv1.AddVolumeOptions) error
 	RemoveVolumeFromVMI(ctx context.Context, namespace string, vmName string, hotPlugRequest *kubevirtv1.RemoveVolumeOptions) error
 	EnsureVolumeAvailable(ctx context.Context, namespace, vmName, volumeName string, timeout time.Duration) error
 	EnsureVolumeAvailableVM(ctx context.Context, namespace, name, volumeName string) (bool, error)
@@ -93,6 +98,7 @@ type client struct {
 	infraTenantStorageSnapshotMapping          []InfraTenantStorageSnapshotMapping
 	infraTenantStorageSnapshotMappingPopulated bool
 	mu                                         sync.Mutex
+	cache                                      *infraCache
 }
 
 // NewClient New creates our client wrapper object for the actual kubeVirt and kubernetes clients we use.
@@ -201,9 +207,21 @@ func (c *client) RemoveVolumeFromVM(ctx context.Context, namespace string, vmNam
 	return c.restClient.Put().AbsPath(uri).Body([]byte(JSON)).Do(ctx).Error()
 }
 
+// AddVolumeToVMI performs a hotplug of a DataVolume to a VMI that isn't managed by a VM
+func (c *client) AddVolumeToVMI(ctx context.Context, namespace string, vmiName string, hotPlugRequest *kubevirtv1.AddVolumeOptions) error {
+	uri := fmt.Sprintf(vmiSubresourceURL, kubevirtv1.ApiStorageVersion, namespace, vmiName, "addvolume")
+
+	JSON, err := json.Marshal(hotPlugRequest)
+
+	if err != nil {
+		return err
+	}
+
+	return c.restClient.Put().AbsPath(uri).Body([]byte(JSON)).Do(ctx).Error()
+}
+
 // RemoveVolumeFromVMI perform hotunplug of a DataVolume from a VMI
 func (c *client) RemoveVolumeFromVMI(ctx context.Context, namespace string, vmName string, hotPlugRequest *kubevirtv1.RemoveVolumeOptions) error {
-	vmiSubresourceURL := "/apis/subresources.kubevirt.io/%s/namespaces/%s/virtualmachineinstances/%s/%s"
 	uri := fmt.Sprintf(vmiSubresourceURL, kubevirtv1.ApiStorageVersion, namespace, vmName, "removevolume")
 
 	JSON, err := json.Marshal(hotPlugRequest)
@@ -215,50 +233,84 @@ func (c *client) RemoveVolumeFromVMI(ctx context.Context, namespace string, vmNa
 	return c.restClient.Put().AbsPath(uri).Body([]byte(JSON)).Do(ctx).Error()
 }
 
-// EnsureVolumeAvailable checks to make sure the volume is available in the node before returning, checks for 2 minutes
+// EnsureVolumeAvailable waits until the volume is ready in the VMI and part of the VM spec, for at most timeout. VMIs
+// that aren't managed by a VM only have their status to go by, and stopped VMs only their spec, which is all it takes
+// for the volume to be there when the VM boots. When the volume doesn't become ready, the error describes its hotplug
+// state.
 func (c *client) EnsureVolumeAvailable(ctx context.Context, namespace, vmName, volumeName string, timeout time.Duration) error {
-	return wait.PollUntilContextTimeout(ctx, time.Second, timeout, true, func(ctx context.Context) (done bool, err error) {
-		vmi, err := c.GetVirtualMachine(ctx, namespace, vmName)
-		if err != nil {
-			return false, err
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	managedByVM, stopped := false, false
+	err := c.waitForVirtualMachineInstance(ctx, namespace, vmName, func(vmi *kubevirtv1.VirtualMachineInstance) (bool, error) {
+		if vmi == nil {
+			stopped = true
+			return true, nil
+		}
+		managedByVM = isManagedByVM(vmi)
+		if isMigrating(vmi) {
+			// The volume status still describes the source node, wait until it's ready on the target.
+			return false, nil
 		}
 		for _, volume := range vmi.Status.VolumeStatus {
 			if volume.Name == volumeName && volume.Phase == kubevirtv1.VolumeReady {
-				return c.EnsureVolumeAvailableVM(ctx, namespace, vmName, volumeName)
+				return true, nil
 			}
 		}
-
 		return false, nil
 	})
+	if err != nil {
+		if diagnostics := c.hotplugDiagnostics(namespace, vmName, volumeName); diagnostics != "" {
+			return fmt.Errorf("%w (%s)", err, diagnostics)
+		}
+		return err
+	}
+	if !managedByVM && !stopped {
+		return nil
+	}
+	return c.waitForVirtualMachine(ctx, namespace, vmName, func(vm *kubevirtv1.VirtualMachine) (bool, error) {
+		if vm == nil && stopped {
+			return false, errors.NewNotFound(kubevirtv1.Resource("virtualmachines"), vmName)
+		}
+		// No VM, something's not right, can't assume availability
+		return vm != nil && hasVolume(vm, volumeName), nil
+	})
 }
 
-// EnsureVolumeRemoved checks to make sure the volume is removed from the node before returning, checks for 2 minutes
+// EnsureVolumeRemoved waits until the volume is gone from both the VMI status and the VM spec, for at most timeout
 func (c *client) EnsureVolumeRemoved(ctx context.Context, namespace, vmName, volumeName string, timeout time.Duration) error {
-	return wait.PollUntilContextTimeout(ctx, time.Second, timeout, true, func(ctx context.Context) (done bool, err error) {
-		vmi, err := c.GetVirtualMachine(ctx, namespace, vmName)
-		if err != nil {
-			if !errors.IsNotFound(err) {
-				return false, err
-			}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := c.waitForVirtualMachineInstance(ctx, namespace, vmName, func(vmi *kubevirtv1.VirtualMachineInstance) (bool, error) {
+		if vmi == nil {
 			// No VMI, volume considered removed if it's not on the VM
-			return c.EnsureVolumeRemovedVM(ctx, namespace, vmName, volumeName)
+			return true, nil
 		}
 		for _, volume := range vmi.Status.VolumeStatus {
 			if volume.Name == volumeName {
 				return false, nil
 			}
 		}
-
-		return c.EnsureVolumeRemovedVM(ctx, namespace, vmName, volumeName)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.waitForVirtualMachine(ctx, namespace, vmName, func(vm *kubevirtv1.VirtualMachine) (bool, error) {
+		// No VM, vacuously removed
+		return vm == nil || !hasVolume(vm, volumeName), nil
 	})
 }
 
-// EnsureSnapshotReady checks to make sure the snapshot is ready before returning, checks for 2 minutes
+// EnsureSnapshotReady waits until the snapshot is ready to use, for at most timeout
 func (c *client) EnsureSnapshotReady(ctx context.Context, namespace, name string, timeout time.Duration) error {
-	return wait.PollUntilContextTimeout(ctx, time.Second, timeout, true, func(ctx context.Context) (done bool, err error) {
-		snapshot, err := c.GetVolumeSnapshot(ctx, namespace, name)
-		if err != nil {
-			return false, err
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return c.waitForVolumeSnapshot(ctx, namespace, name, func(snapshot *snapshotv1.VolumeSnapshot) (bool, error) {
+		if snapshot == nil {
+			return false, errors.NewNotFound(snapshotv1.Resource("volumesnapshots"), name)
+		}
+		if !containsLabels(snapshot.Labels, c.infraLabelMap) {
+			return false, ErrInvalidSnapshot
 		}
 		if snapshot.Status != nil && snapshot.Status.ReadyToUse != nil {
 			return *snapshot.Status.ReadyToUse, nil
@@ -267,32 +319,44 @@ func (c *client) EnsureSnapshotReady(ctx context.Context, namespace, name string
 	})
 }
 
-// EnsureControllerResize checks that a ControllerExpandVolume is finished on the infra storage, checks for 2 minutes
+// EnsureControllerResize waits until a ControllerExpandVolume is finished on the infra storage, for at most timeout
 func (c *client) EnsureControllerResize(ctx context.Context, namespace, claimName string, timeout time.Duration) error {
 	pvc, err := c.GetPersistentVolumeClaim(ctx, namespace, claimName)
 	if err != nil {
 		return err
 	}
 	pvName := pvc.Spec.VolumeName
-	return wait.PollUntilContextTimeout(ctx, time.Second, timeout, true, func(ctx context.Context) (done bool, err error) {
-		pvcSize := pvc.Spec.Resources.Requests[k8sv1.ResourceStorage]
-		pv, err := c.infraKubernetesClient.CoreV1().PersistentVolumes().Get(ctx, pvName, metav1.GetOptions{})
-		if err != nil {
-			return false, fmt.Errorf("error fetching pv %q for resizing %v", pvName, err)
+	pvcSize := pvc.Spec.Resources.Requests[k8sv1.ResourceStorage]
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return c.waitForPersistentVolume(ctx, pvName, func(pv *k8sv1.PersistentVolume) (bool, error) {
+		if pv == nil {
+			return false, fmt.Errorf("error fetching pv %q for resizing %v", pvName, errors.NewNotFound(k8sv1.Resource("persistentvolumes"), pvName))
 		}
 		pvSize := pv.Spec.Capacity[k8sv1.ResourceStorage]
 		// If pv size is greater or equal to requested size that means controller resize is finished
 		// https://github.com/kubernetes/kubernetes/blob/6a17858ff9be5601149ded54eb33280adc2783b3/test/e2e/storage/testsuites/volume_expand.go#L419
-		if pvSize.Cmp(pvcSize) >= 0 {
-			return true, nil
-		}
-
-		return false, nil
+		return pvSize.Cmp(pvcSize) >= 0, nil
 	})
 }
 
+// StartInformers starts the informer cache for namespace in the background, it doesn't wait for the informers to sync.
+// Reads in that namespace are served from the informers that have synced, and from the API server for the others.
+func (c *client) StartInformers(ctx context.Context, namespace string) error {
+	ic, err := newInfraCache(c, namespace)
+	if err != nil {
+		return err
+	}
+	c.cache = ic
+	go ic.start(ctx)
+	return nil
+}
+
 // ListVirtualMachines fetches a list of VMIs from the passed in namespace
 func (c *client) ListVirtualMachines(ctx context.Context, namespace string) ([]kubevirtv1.VirtualMachineInstance, error) {
+	if informer := c.cache.informer(ctx, namespace, vmiInformer); informer != nil {
+		return toVMIs(listCached[*kubevirtv1.VirtualMachineInstance](informer, cache.NamespaceIndex, namespace))
+	}
 	list, err := c.virtClient.KubevirtV1().VirtualMachineInstances(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
@@ -300,16 +364,99 @@ func (c *client) ListVirtualMachines(ctx context.Context, namespace string) ([]k
 	return list.Items, nil
 }
 
+// ListVirtualMachinesWithVolume fetches the VMIs from the passed in namespace that report volumeName in their status
+func (c *client) ListVirtualMachinesWithVolume(ctx context.Context, namespace, volumeName string) ([]kubevirtv1.VirtualMachineInstance, error) {
+	if informer := c.cache.informer(ctx, namespace, vmiInformer); informer != nil {
+		return toVMIs(listCached[*kubevirtv1.VirtualMachineInstance](informer, vmiVolumeIndex, volumeName))
+	}
+	vmis, err := c.ListVirtualMachines(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var result []kubevirtv1.VirtualMachineInstance
+	for _, vmi := range vmis {
+		for _, volumeStatus := range vmi.Status.VolumeStatus {
+			if volumeStatus.Name == volumeName {
+				result = append(result, vmi)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func toVMIs(vmis []*kubevirtv1.VirtualMachineInstance, err error) ([]kubevirtv1.VirtualMachineInstance, error) {
+	if err != nil {
+		return nil, err
+	}
+	result := make([]kubevirtv1.VirtualMachineInstance, 0, len(vmis))
+	for _, vmi := range vmis {
+		result = append(result, *vmi)
+	}
+	return result, nil
+}
+
 // GetVirtualMachine gets a VMIs from the passed in namespace
 func (c *client) GetVirtualMachine(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachineInstance, error) {
+	if informer := c.cache.informer(ctx, namespace, vmiInformer); informer != nil {
+		vmi, found, err := getCached[*kubevirtv1.VirtualMachineInstance](informer, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errors.NewNotFound(kubevirtv1.Resource("virtualmachineinstances"), name)
+		}
+		return vmi, nil
+	}
 	return c.virtClient.KubevirtV1().VirtualMachineInstances(namespace).Get(ctx, name, metav1.GetOptions{})
 }
 
 // GetWorkloadManagingVirtualMachine gets a VM from the passed in namespace
 func (c *client) GetWorkloadManagingVirtualMachine(ctx context.Context, namespace, name string) (*kubevirtv1.VirtualMachine, error) {
+	if informer := c.cache.informer(ctx, namespace, vmInformer); informer != nil {
+		vm, found, err := getCached[*kubevirtv1.VirtualMachine](informer, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errors.NewNotFound(kubevirtv1.Resource("virtualmachines"), name)
+		}
+		return vm, nil
+	}
 	return c.virtClient.KubevirtV1().VirtualMachines(namespace).Get(ctx, name, metav1.GetOptions{})
 }
 
+// GetActiveMigration returns the migration of the VMI that has not finished yet, or nil if there is none. KubeVirt
+// labels every migration with the name of its VMI.
+func (c *client) GetActiveMigration(ctx context.Context, namespace, vmiName string) (*kubevirtv1.VirtualMachineInstanceMigration, error) {
+	migrations, err := c.virtClient.KubevirtV1().VirtualMachineInstanceMigrations(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{kubevirtv1.MigrationSelectorLabel: vmiName}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range migrations.Items {
+		migration := &migrations.Items[i]
+		if !migration.IsFinal() {
+			return migration, nil
+		}
+	}
+	return nil, nil
+}
+
+// isManagedByVM returns true when the VMI is controlled by a VM, rather than being standalone or part of a
+// VirtualMachineInstanceReplicaSet.
+func isManagedByVM(vmi *kubevirtv1.VirtualMachineInstance) bool {
+	owner := metav1.GetControllerOf(vmi)
+	return owner != nil && owner.Kind == kubevirtv1.VirtualMachineGroupVersionKind.Kind
+}
+
+// isMigrating returns true while the VMI is being moved to another node.
+func isMigrating(vmi *kubevirtv1.VirtualMachineInstance) bool {
+	state := vmi.Status.MigrationState
+	return state != nil && state.StartTimestamp != nil && !state.Completed && !state.Failed
+}
+
 // CreateDataVolume creates a new DataVolume under a namespace
 func (c *client) CreateDataVolume(ctx context.Context, namespace string, dataVolume *cdiv1.DataVolume) (*cdiv1.DataVolume, error) {
 	if !strings.HasPrefix(dataVolume.GetName(), c.volumePrefix) {
@@ -338,7 +485,7 @@ func (c *client) DeleteDataVolume(ctx context.Context, namespace string, name st
 }
 
 func (c *client) GetDataVolume(ctx context.Context, namespace string, name string) (*cdiv1.DataVolume, error) {
-	dv, err := c.cdiClient.CdiV1beta1().DataVolumes(namespace).Get(ctx, name, metav1.GetOptions{})
+	dv, err := c.getDataVolume(ctx, namespace, name)
 	if err != nil {
 		return nil, err
 	}
@@ -351,7 +498,7 @@ func (c *client) GetDataVolume(ctx context.Context, namespace string, name strin
 }
 
 func (c *client) GetPersistentVolumeClaim(ctx context.Context, namespace string, claimName string) (*k8sv1.PersistentVolumeClaim, error) {
-	pvc, err := c.infraKubernetesClient.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, claimName, metav1.GetOptions{})
+	pvc, err := c.getPersistentVolumeClaim(ctx, namespace, claimName)
 	if err != nil {
 		klog.Errorf("Error getting volume claim %s in namespace %s: %v", claimName, namespace, err)
 		return nil, err
@@ -509,7 +656,7 @@ func (c *client) getStorageClassNameFromClaimName(ctx context.Context, namespace
 }
 
 func (c *client) GetVolumeSnapshot(ctx context.Context, namespace, name string) (*snapshotv1.VolumeSnapshot, error) {
-	s, err := c.infraSnapClient.SnapshotV1().VolumeSnapshots(namespace).Get(ctx, name, metav1.GetOptions{})
+	s, err := c.getVolumeSnapshot(ctx, namespace, name)
 	if err != nil {
 		return nil, err
 	}
@@ -537,6 +684,19 @@ func (c *client) ListVolumeSnapshots(ctx context.Context, namespace string) (*sn
 	if err != nil {
 		return nil, err
 	}
+	if informer := c.cache.informer(ctx, namespace, snapshotInformer); informer != nil {
+		snapshots, err := listCached[*snapshotv1.VolumeSnapshot](informer, cache.NamespaceIndex, namespace)
+		if err != nil {
+			return nil, err
+		}
+		list := &snapshotv1.VolumeSnapshotList{}
+		for _, snapshot := range snapshots {
+			if sl.Matches(labels.Set(snapshot.Labels)) {
+				list.Items = append(list.Items, *snapshot)
+			}
+		}
+		return list, nil
+	}
 	return c.infraSnapClient.SnapshotV1().VolumeSnapshots(namespace).List(ctx, metav1.ListOptions{
 		LabelSelector: sl.String(),
 	})
@@ -585,7 +745,7 @@ func appendVolumeSnapshotInfraTenantMapping(mapping *InfraTenantStorageSnapshotM
 }
 
 func (c *client) EnsureVolumeRemovedVM(ctx context.Context, namespace, name, volumeName string) (bool, error) {
-	vm, err := c.virtClient.KubevirtV1().VirtualMachines(namespace).Get(ctx, name, metav1.GetOptions{})
+	vm, err := c.GetWorkloadManagingVirtualMachine(ctx, namespace, name)
 	if err != nil {
 		if !errors.IsNotFound(err) {
 			return false, err
@@ -594,16 +754,7 @@ func (c *client) EnsureVolumeRemovedVM(ctx context.Context, namespace, name, vol
 		return true, nil
 	}
 
-	for _, volume := range vm.Spec.Template.Spec.Volumes {
-		if volume.PersistentVolumeClaim == nil && volume.DataVolume == nil {
-			continue
-		}
-		if volume.Name == volumeName {
-			return false, nil
-		}
-	}
-
-	return true, nil
+	return !hasVolume(vm, volumeName), nil
 }
 
 // EnsureVolumeRemovedVMI returns true when the VMI no longer reports the
@@ -613,7 +764,7 @@ func (c *client) EnsureVolumeRemovedVM(ctx context.Context, namespace, name, vol
 // is still around, or when virt-api mutated VM.spec optimistically but
 // virt-handler has not unplugged the device yet.
 func (c *client) EnsureVolumeRemovedVMI(ctx context.Context, namespace, name, volumeName string) (bool, error) {
-	vmi, err := c.virtClient.KubevirtV1().VirtualMachineInstances(namespace).Get(ctx, name, metav1.GetOptions{})
+	vmi, err := c.GetVirtualMachine(ctx, namespace, name)
 	if err != nil {
 		if !errors.IsNotFound(err) {
 			return false, err
@@ -635,7 +786,7 @@ func (c *client) EnsureVolumeRemovedVMI(ctx context.Context, namespace, name, vo
 }
 
 func (c *client) EnsureVolumeAvailableVM(ctx context.Context, namespace, name, volumeName string) (bool, error) {
-	vm, err := c.virtClient.KubevirtV1().VirtualMachines(namespace).Get(ctx, name, metav1.GetOptions{})
+	vm, err := c.GetWorkloadManagingVirtualMachine(ctx, namespace, name)
 	if err != nil {
 		if !errors.IsNotFound(err) {
 			return false, err
@@ -644,17 +795,52 @@ func (c *client) EnsureVolumeAvailableVM(ctx context.Context, namespace, name, v
 		return false, nil
 	}
 
+	return hasVolume(vm, volumeName), nil
+}
+
+// hasVolume returns true when the VM spec contains a PVC or DataVolume volume called volumeName.
+func hasVolume(vm *kubevirtv1.VirtualMachine, volumeName string) bool {
 	for _, volume := range vm.Spec.Template.Spec.Volumes {
 		if volume.PersistentVolumeClaim == nil && volume.DataVolume == nil {
 			continue
 		}
 		if volume.Name == volumeName {
-			return true, nil
+			return true
 		}
 	}
-
-	return false, nil
+	return false
 }
 
 var ErrInvalidSnapshot = goerrors.New("invalid snapshot name")
 var ErrInvalidVolume = goerrors.New("invalid volume name")
+
+// getDataVolume reads the DataVolume from the cache, falling back to the API server for DataVolumes the cache hasn't
+// seen yet, or that don't carry the infra cluster labels.
+func (c *client) getDataVolume(ctx context.Context, namespace, name string) (*cdiv1.DataVolume, error) {
+	if informer := c.cache.informer(ctx, namespace, dataVolumeInformer); informer != nil {
+		if dv, found, err := getCached[*cdiv1.DataVolume](informer, namespace, name); err != nil || found {
+			return dv, err
+		}
+	}
+	return c.cdiClient.CdiV1beta1().DataVolumes(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// getPersistentVolumeClaim reads the PVC from the cache, falling back to the API server on a miss.
+func (c *client) getPersistentVolumeClaim(ctx context.Context, namespace, name string) (*k8sv1.PersistentVolumeClaim, error) {
+	if informer := c.cache.informer(ctx, namespace, pvcInformer); informer != nil {
+		if pvc, found, err := getCached[*k8sv1.PersistentVolumeClaim](informer, namespace, name); err != nil || found {
+			return pvc, err
+		}
+	}
+	return c.infraKubernetesClient.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// getVolumeSnapshot reads the VolumeSnapshot from the cache, falling back to the API server on a miss.
+func (c *client) getVolumeSnapshot(ctx context.Context, namespace, name string) (*snapshotv1.VolumeSnapshot, error) {
+	if informer := c.cache.informer(ctx, namespace, snapshotInformer); informer != nil {
+		if snapshot, found, err := getCached[*snapshotv1.VolumeSnapshot](informer, namespace, name); err != nil || found {
+			return snapshot, err
+		}
+	}
+	return c.infraSnapClient.SnapshotV1().VolumeSnapshots(namespace).Get(ctx, name, metav1.GetOptions{})
+}
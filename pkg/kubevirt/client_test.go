@@ -2,6 +2,8 @@ package kubevirt
 
 import (
 	"context"
+	goerrors "errors"
+	"time"
 
 	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
 	. "github.com/onsi/ginkgo/v2"
@@ -12,12 +14,17 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/utils/ptr"
+	kubevirtv1 "kubevirt.io/api/core/v1"
 	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
 	cdicli "kubevirt.io/csi-driver/pkg/generated/containerized-data-importer/client-go/clientset/versioned/fake"
 	snapcli "kubevirt.io/csi-driver/pkg/generated/external-snapshotter/client-go/clientset/versioned"
 	snapfake "kubevirt.io/csi-driver/pkg/generated/external-snapshotter/client-go/clientset/versioned/fake"
+	kubevirtfake "kubevirt.io/csi-driver/pkg/generated/kubevirt/client-go/clientset/versioned/fake"
 	"kubevirt.io/csi-driver/pkg/util"
 )
 
@@ -319,6 +326,327 @@ var _ = Describe("Client", func() {
 		)
 	})
 
+	Context("Migrations", func() {
+		const vmiName = "test-vm"
+
+		createMigration := func(name, vmiName string, phase kubevirtv1.VirtualMachineInstanceMigrationPhase) *kubevirtv1.VirtualMachineInstanceMigration {
+			return &kubevirtv1.VirtualMachineInstanceMigration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: testNamespace,
+					Labels:    map[string]string{kubevirtv1.MigrationSelectorLabel: vmiName},
+				},
+				Spec:   kubevirtv1.VirtualMachineInstanceMigrationSpec{VMIName: vmiName},
+				Status: kubevirtv1.VirtualMachineInstanceMigrationStatus{Phase: phase},
+			}
+		}
+
+		BeforeEach(func() {
+			c = NewFakeClient()
+		})
+
+		It("should return the migration that is still running", func() {
+			c.virtClient = kubevirtfake.NewSimpleClientset(
+				createMigration("done", vmiName, kubevirtv1.MigrationSucceeded),
+				createMigration("other", "other-vm", kubevirtv1.MigrationRunning),
+				createMigration("running", vmiName, kubevirtv1.MigrationRunning),
+			)
+			migration, err := c.GetActiveMigration(context.TODO(), testNamespace, vmiName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(migration).ToNot(BeNil())
+			Expect(migration.Name).To(Equal("running"))
+		})
+
+		It("should return nil when all migrations are done", func() {
+			c.virtClient = kubevirtfake.NewSimpleClientset(
+				createMigration("failed", vmiName, kubevirtv1.MigrationFailed),
+				createMigration("done", vmiName, kubevirtv1.MigrationSucceeded),
+			)
+			migration, err := c.GetActiveMigration(context.TODO(), testNamespace, vmiName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(migration).To(BeNil())
+		})
+	})
+
+	Context("Waiting for state changes", func() {
+		const (
+			vmName     = "test-vm"
+			volumeName = "test-volume"
+		)
+		var (
+			virtClient *kubevirtfake.Clientset
+			vmiWatch   *watch.FakeWatcher
+		)
+
+		BeforeEach(func() {
+			c = NewFakeClient()
+			vmiWatch = watch.NewFake()
+			virtClient = kubevirtfake.NewSimpleClientset(createVirtualMachineInstance(vmName), createVirtualMachine(vmName, volumeName))
+			virtClient.PrependWatchReactor("virtualmachineinstances", k8stesting.DefaultWatchReactor(vmiWatch, nil))
+			c.virtClient = virtClient
+		})
+
+		It("should return once the VMI reports the volume ready", func() {
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- c.EnsureVolumeAvailable(context.TODO(), testNamespace, vmName, volumeName, time.Minute)
+			}()
+			Consistently(errCh).ShouldNot(Receive())
+
+			vmi := createVirtualMachineInstance(vmName)
+			vmi.Status.VolumeStatus = []kubevirtv1.VolumeStatus{{Name: volumeName, Phase: kubevirtv1.VolumeReady}}
+			vmiWatch.Modify(vmi)
+			Eventually(errCh).Should(Receive(BeNil()))
+		})
+
+		It("should only wait for the VM spec of a stopped VM", func() {
+			Expect(virtClient.Tracker().Delete(kubevirtv1.GroupVersion.WithResource("virtualmachineinstances"), testNamespace, vmName)).To(Succeed())
+
+			Expect(c.EnsureVolumeAvailable(context.TODO(), testNamespace, vmName, volumeName, time.Minute)).To(Succeed())
+			err := c.EnsureVolumeAvailable(context.TODO(), testNamespace, vmName, "other-volume", 10*time.Millisecond)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("should fail when neither the VM nor the VMI exist", func() {
+			Expect(virtClient.Tracker().Delete(kubevirtv1.GroupVersion.WithResource("virtualmachineinstances"), testNamespace, vmName)).To(Succeed())
+			Expect(virtClient.Tracker().Delete(kubevirtv1.GroupVersion.WithResource("virtualmachines"), testNamespace, vmName)).To(Succeed())
+
+			err := c.EnsureVolumeAvailable(context.TODO(), testNamespace, vmName, volumeName, time.Minute)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should only wait for the VMI status of a VMI without a VM", func() {
+			Expect(virtClient.Tracker().Delete(kubevirtv1.GroupVersion.WithResource("virtualmachines"), testNamespace, vmName)).To(Succeed())
+			vmi := createVirtualMachineInstance(vmName)
+			vmi.Status.VolumeStatus = []kubevirtv1.VolumeStatus{{Name: volumeName, Phase: kubevirtv1.VolumeReady}}
+			Expect(virtClient.Tracker().Update(kubevirtv1.GroupVersion.WithResource("virtualmachineinstances"), vmi, testNamespace)).To(Succeed())
+
+			Expect(c.EnsureVolumeAvailable(context.TODO(), testNamespace, vmName, volumeName, time.Minute)).To(Succeed())
+		})
+
+		It("should wait for the VM of a VMI managed by a VM", func() {
+			vm := createVirtualMachine(vmName, "other-volume")
+			Expect(virtClient.Tracker().Update(kubevirtv1.GroupVersion.WithResource("virtualmachines"), vm, testNamespace)).To(Succeed())
+			vmi := createVirtualMachineInstance(vmName)
+			vmi.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(vm, kubevirtv1.VirtualMachineGroupVersionKind)}
+			vmi.Status.VolumeStatus = []kubevirtv1.VolumeStatus{{Name: volumeName, Phase: kubevirtv1.VolumeReady}}
+			Expect(virtClient.Tracker().Update(kubevirtv1.GroupVersion.WithResource("virtualmachineinstances"), vmi, testNamespace)).To(Succeed())
+
+			err := c.EnsureVolumeAvailable(context.TODO(), testNamespace, vmName, volumeName, 10*time.Millisecond)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("should describe the hotplug state of the volume when it doesn't become ready", func() {
+			vmi := createVirtualMachineInstance(vmName)
+			vmi.Status.VolumeStatus = []kubevirtv1.VolumeStatus{{
+				Name:          volumeName,
+				Phase:         kubevirtv1.VolumePending,
+				Reason:        "PVCNotReady",
+				Message:       "PVC is in phase Pending",
+				HotplugVolume: &kubevirtv1.HotplugVolumeStatus{AttachPodName: "hp-volume-abc"},
+			}}
+			Expect(virtClient.Tracker().Update(kubevirtv1.GroupVersion.WithResource("virtualmachineinstances"), vmi, testNamespace)).To(Succeed())
+			c.infraKubernetesClient = k8sfake.NewSimpleClientset(
+				&k8sv1.Event{
+					ObjectMeta:     metav1.ObjectMeta{Name: "scheduling", Namespace: testNamespace},
+					InvolvedObject: k8sv1.ObjectReference{Kind: "Pod", Name: "hp-volume-abc"},
+					Type:           k8sv1.EventTypeWarning,
+					Reason:         "FailedScheduling",
+					Message:        "0/3 nodes are available",
+				},
+				&k8sv1.Event{
+					ObjectMeta:     metav1.ObjectMeta{Name: "pulled", Namespace: testNamespace},
+					InvolvedObject: k8sv1.ObjectReference{Kind: "Pod", Name: "hp-volume-abc"},
+					Type:           k8sv1.EventTypeNormal,
+					Reason:         "Pulled",
+				},
+			)
+
+			err := c.EnsureVolumeAvailable(context.TODO(), testNamespace, vmName, volumeName, 10*time.Millisecond)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(err.Error()).To(ContainSubstring("volume phase: Pending, reason: PVCNotReady, message: PVC is in phase Pending"))
+			Expect(err.Error()).To(ContainSubstring("pod hp-volume-abc: FailedScheduling: 0/3 nodes are available"))
+			Expect(err.Error()).ToNot(ContainSubstring("Pulled"))
+		})
+
+		It("should wait for a migrating VMI to report the volume ready on the target", func() {
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- c.EnsureVolumeAvailable(context.TODO(), testNamespace, vmName, volumeName, time.Minute)
+			}()
+
+			vmi := createVirtualMachineInstance(vmName)
+			vmi.Status.VolumeStatus = []kubevirtv1.VolumeStatus{{Name: volumeName, Phase: kubevirtv1.VolumeReady}}
+			vmi.Status.MigrationState = &kubevirtv1.VirtualMachineInstanceMigrationState{StartTimestamp: &metav1.Time{Time: time.Now()}}
+			vmiWatch.Modify(vmi)
+			Consistently(errCh).ShouldNot(Receive())
+
+			vmi = vmi.DeepCopy()
+			vmi.Status.MigrationState.Completed = true
+			vmiWatch.Modify(vmi)
+			Eventually(errCh).Should(Receive(BeNil()))
+		})
+
+		It("should consider the volume removed once the VMI and VM are gone", func() {
+			Expect(virtClient.Tracker().Delete(kubevirtv1.GroupVersion.WithResource("virtualmachines"), testNamespace, vmName)).To(Succeed())
+			vmi := createVirtualMachineInstance(vmName)
+			vmi.Status.VolumeStatus = []kubevirtv1.VolumeStatus{{Name: volumeName, Phase: kubevirtv1.VolumeReady}}
+			Expect(virtClient.Tracker().Update(kubevirtv1.GroupVersion.WithResource("virtualmachineinstances"), vmi, testNamespace)).To(Succeed())
+
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- c.EnsureVolumeRemoved(context.TODO(), testNamespace, vmName, volumeName, time.Minute)
+			}()
+			Consistently(errCh).ShouldNot(Receive())
+
+			vmiWatch.Delete(vmi)
+			Eventually(errCh).Should(Receive(BeNil()))
+		})
+
+		It("should list again when the watch is closed", func() {
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- c.EnsureVolumeAvailable(context.TODO(), testNamespace, vmName, volumeName, time.Minute)
+			}()
+			Consistently(errCh).ShouldNot(Receive())
+
+			vmi := createVirtualMachineInstance(vmName)
+			vmi.Status.VolumeStatus = []kubevirtv1.VolumeStatus{{Name: volumeName, Phase: kubevirtv1.VolumeReady}}
+			Expect(virtClient.Tracker().Update(kubevirtv1.GroupVersion.WithResource("virtualmachineinstances"), vmi, testNamespace)).To(Succeed())
+			vmiWatch.Stop()
+			Eventually(errCh, 5*time.Second).Should(Receive(BeNil()))
+		})
+
+		It("should return once the snapshot is ready to use", func() {
+			snapshotWatch := watch.NewFake()
+			snapClient := snapfake.NewSimpleClientset(createVolumeSnapshot("snap", false))
+			snapClient.PrependWatchReactor("volumesnapshots", k8stesting.DefaultWatchReactor(snapshotWatch, nil))
+			c.infraSnapClient = snapClient
+
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- c.EnsureSnapshotReady(context.TODO(), testNamespace, "snap", time.Minute)
+			}()
+			Consistently(errCh).ShouldNot(Receive())
+
+			snapshotWatch.Modify(createVolumeSnapshot("snap", true))
+			Eventually(errCh).Should(Receive(BeNil()))
+		})
+
+		It("should time out if the snapshot never becomes ready", func() {
+			c.infraSnapClient = snapfake.NewSimpleClientset(createVolumeSnapshot("snap", false))
+			err := c.EnsureSnapshotReady(context.TODO(), testNamespace, "snap", 100*time.Millisecond)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+
+	Context("Informer cache", func() {
+		const vmName = "test-vm"
+		var virtClient *kubevirtfake.Clientset
+
+		BeforeEach(func() {
+			c = NewFakeCdiClient(NewFakeClient(), createValidDataVolume(), createNoLabelDataVolume())
+			vmi := createVirtualMachineInstance(vmName)
+			vmi.Status.VolumeStatus = []kubevirtv1.VolumeStatus{{Name: validDataVolume}}
+			virtClient = kubevirtfake.NewSimpleClientset(vmi, createVirtualMachine(vmName, validDataVolume))
+			c.virtClient = virtClient
+
+			ctx, cancel := context.WithCancel(context.Background())
+			DeferCleanup(cancel)
+			Expect(c.StartInformers(ctx, testNamespace)).To(Succeed())
+			Eventually(func() bool {
+				return c.cache.informer(context.TODO(), testNamespace, vmiInformer) != nil &&
+					c.cache.informer(context.TODO(), testNamespace, vmInformer) != nil &&
+					c.cache.informer(context.TODO(), testNamespace, dataVolumeInformer) != nil
+			}).Should(BeTrue())
+		})
+
+		It("should serve VMs and VMIs from the cache", func() {
+			virtClient.ClearActions()
+			vmi, err := c.GetVirtualMachine(context.TODO(), testNamespace, vmName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vmi.Name).To(Equal(vmName))
+			available, err := c.EnsureVolumeAvailableVM(context.TODO(), testNamespace, vmName, validDataVolume)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(available).To(BeTrue())
+			_, err = c.GetWorkloadManagingVirtualMachine(context.TODO(), testNamespace, "missing")
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(virtClient.Actions()).To(BeEmpty())
+		})
+
+		It("should read from the API server when asked for live reads", func() {
+			virtClient.ClearActions()
+			vm, err := c.GetWorkloadManagingVirtualMachine(WithLiveReads(context.TODO()), testNamespace, vmName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vm.Name).To(Equal(vmName))
+			Expect(virtClient.Actions()).To(HaveLen(1))
+			Expect(virtClient.Actions()[0].GetVerb()).To(Equal("get"))
+		})
+
+		It("should look up VMIs by volume name", func() {
+			vmis, err := c.ListVirtualMachinesWithVolume(context.TODO(), testNamespace, validDataVolume)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vmis).To(HaveLen(1))
+			Expect(vmis[0].Name).To(Equal(vmName))
+			vmis, err = c.ListVirtualMachinesWithVolume(context.TODO(), testNamespace, "other-volume")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vmis).To(BeEmpty())
+		})
+
+		It("should read the resources it may not list from the API server", func() {
+			virtClient = kubevirtfake.NewSimpleClientset(createVirtualMachine(vmName, validDataVolume))
+			virtClient.PrependReactor("list", "virtualmachines", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.NewForbidden(kubevirtv1.Resource("virtualmachines"), "", goerrors.New("no list permission"))
+			})
+			c.virtClient = virtClient
+			snapClient := snapfake.NewSimpleClientset(createVolumeSnapshot("snap", true))
+			snapClient.PrependReactor("list", "volumesnapshots", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.NewNotFound(snapshotv1.Resource("volumesnapshots"), "")
+			})
+			c.infraSnapClient = snapClient
+			ctx, cancel := context.WithCancel(context.Background())
+			DeferCleanup(cancel)
+			Expect(c.StartInformers(ctx, testNamespace)).To(Succeed())
+			Eventually(c.cache.started).Should(BeClosed())
+
+			virtClient.ClearActions()
+			vm, err := c.GetWorkloadManagingVirtualMachine(context.TODO(), testNamespace, vmName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(vm.Name).To(Equal(vmName))
+			Expect(virtClient.Actions()).To(HaveLen(1))
+			snapClient.ClearActions()
+			snapshot, err := c.GetVolumeSnapshot(context.TODO(), testNamespace, "snap")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshot.Name).To(Equal("snap"))
+			Expect(snapClient.Actions()).To(HaveLen(1))
+		})
+
+		It("should not wait for informers that don't sync", func() {
+			pvcClient := k8sfake.NewSimpleClientset(createPersistentVolumeClaim(testClaimName, testVolumeName, nil))
+			pvcClient.PrependReactor("list", "persistentvolumeclaims", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.NewServiceUnavailable("the API server is overloaded")
+			})
+			c.infraKubernetesClient = pvcClient
+			ctx, cancel := context.WithCancel(context.Background())
+			DeferCleanup(cancel)
+			Expect(c.StartInformers(ctx, testNamespace)).To(Succeed())
+
+			Eventually(func() cache.SharedIndexInformer {
+				return c.cache.informer(context.TODO(), testNamespace, vmInformer)
+			}).ShouldNot(BeNil())
+			Consistently(func() cache.SharedIndexInformer {
+				return c.cache.informer(context.TODO(), testNamespace, pvcInformer)
+			}, 100*time.Millisecond).Should(BeNil())
+		})
+
+		It("should fall back to the API server for objects outside of the cache", func() {
+			dv, err := c.GetDataVolume(context.TODO(), testNamespace, validDataVolume)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dv.Name).To(Equal(validDataVolume))
+			_, err = c.GetDataVolume(context.TODO(), testNamespace, nolabelDataVolume)
+			Expect(err).To(Equal(ErrInvalidVolume))
+		})
+	})
 })
 
 func NewFakeCdiClient(c *client, objects ...runtime.Object) *client {
@@ -465,6 +793,49 @@ func createDataVolume(name string, labels map[string]string) *cdiv1.DataVolume {
 	}
 }
 
+func createVirtualMachineInstance(name string) *kubevirtv1.VirtualMachineInstance {
+	return &kubevirtv1.VirtualMachineInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+		},
+	}
+}
+
+func createVirtualMachine(name, volumeName string) *kubevirtv1.VirtualMachine {
+	return &kubevirtv1.VirtualMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+		},
+		Spec: kubevirtv1.VirtualMachineSpec{
+			Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{
+				Spec: kubevirtv1.VirtualMachineInstanceSpec{
+					Volumes: []kubevirtv1.Volume{{
+						Name: volumeName,
+						VolumeSource: kubevirtv1.VolumeSource{
+							DataVolume: &kubevirtv1.DataVolumeSource{Name: volumeName},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func createVolumeSnapshot(name string, ready bool) *snapshotv1.VolumeSnapshot {
+	return &snapshotv1.VolumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+			Labels:    map[string]string{"test": "test"},
+		},
+		Status: &snapshotv1.VolumeSnapshotStatus{
+			ReadyToUse: ptr.To(ready),
+		},
+	}
+}
+
 func createValidDataVolume() *cdiv1.DataVolume {
 	return createDataVolume(validDataVolume, map[string]string{"test": "test"})
 }
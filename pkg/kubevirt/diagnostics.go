@@ -0,0 +1,98 @@
+package kubevirt
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/klog/v2"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+const (
+	// diagnosticsTimeout bounds collecting diagnostics, the context of the failed wait is usually done already.
+	diagnosticsTimeout = 10 * time.Second
+	// maxDiagnosticEvents is how many of the latest warnings of the attachment pod are reported.
+	maxDiagnosticEvents = 3
+)
+
+// hotplugDiagnostics describes why volumeName isn't ready in the VMI: the phase, reason and message of its volume
+// status, and the latest warning events of the pod that attaches it to the node, which tell quota, scheduling and
+// storage problems apart. It returns an empty string when there is nothing to report.
+func (c *client) hotplugDiagnostics(namespace, vmName, volumeName string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+
+	vmi, err := c.GetVirtualMachine(ctx, namespace, vmName)
+	if err != nil {
+		klog.V(3).Infof("Failed to get VMI %s for hotplug diagnostics: %v", vmName, err)
+		return ""
+	}
+	var volumeStatus *kubevirtv1.VolumeStatus
+	for i := range vmi.Status.VolumeStatus {
+		if vmi.Status.VolumeStatus[i].Name == volumeName {
+			volumeStatus = &vmi.Status.VolumeStatus[i]
+			break
+		}
+	}
+	if volumeStatus == nil {
+		return fmt.Sprintf("volume %s has no status in VMI %s", volumeName, vmName)
+	}
+
+	diagnostics := []string{fmt.Sprintf("volume phase: %s", volumeStatus.Phase)}
+	if volumeStatus.Reason != "" {
+		diagnostics = append(diagnostics, fmt.Sprintf("reason: %s", volumeStatus.Reason))
+	}
+	if volumeStatus.Message != "" {
+		diagnostics = append(diagnostics, fmt.Sprintf("message: %s", volumeStatus.Message))
+	}
+	if volumeStatus.HotplugVolume != nil && volumeStatus.HotplugVolume.AttachPodName != "" {
+		podName := volumeStatus.HotplugVolume.AttachPodName
+		events, err := c.podWarnings(ctx, namespace, podName)
+		if err != nil {
+			klog.V(3).Infof("Failed to list events of pod %s for hotplug diagnostics: %v", podName, err)
+		}
+		for _, event := range events {
+			diagnostics = append(diagnostics, fmt.Sprintf("pod %s: %s: %s", podName, event.Reason, event.Message))
+		}
+	}
+	return strings.Join(diagnostics, ", ")
+}
+
+// podWarnings returns the latest warning events of the pod, newest first.
+func (c *client) podWarnings(ctx context.Context, namespace, podName string) ([]k8sv1.Event, error) {
+	eventList, err := c.infraKubernetesClient.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Pod",
+			"involvedObject.name": podName,
+		}.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var warnings []k8sv1.Event
+	for _, event := range eventList.Items {
+		if event.Type == k8sv1.EventTypeWarning && event.InvolvedObject.Name == podName {
+			warnings = append(warnings, event)
+		}
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return eventTime(warnings[j]).Before(eventTime(warnings[i]))
+	})
+	if len(warnings) > maxDiagnosticEvents {
+		warnings = warnings[:maxDiagnosticEvents]
+	}
+	return warnings, nil
+}
+
+func eventTime(event k8sv1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	return event.EventTime.Time
+}
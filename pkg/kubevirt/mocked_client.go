@@ -53,6 +53,20 @@ func (mr *MockClientMockRecorder) AddVolumeToVM(ctx, namespace, vmName, hotPlugR
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddVolumeToVM", reflect.TypeOf((*MockClient)(nil).AddVolumeToVM), ctx, namespace, vmName, hotPlugRequest)
 }
 
+// AddVolumeToVMI mocks base method.
+func (m *MockClient) AddVolumeToVMI(ctx context.Context, namespace, vmiName string, hotPlugRequest *v11.AddVolumeOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddVolumeToVMI", ctx, namespace, vmiName, hotPlugRequest)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddVolumeToVMI indicates an expected call of AddVolumeToVMI.
+func (mr *MockClientMockRecorder) AddVolumeToVMI(ctx, namespace, vmiName, hotPlugRequest interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddVolumeToVMI", reflect.TypeOf((*MockClient)(nil).AddVolumeToVMI), ctx, namespace, vmiName, hotPlugRequest)
+}
+
 // CreateDataVolume mocks base method.
 func (m *MockClient) CreateDataVolume(ctx context.Context, namespace string, dataVolume *v1beta1.DataVolume) (*v1beta1.DataVolume, error) {
 	m.ctrl.T.Helper()
@@ -181,6 +195,21 @@ func (mr *MockClientMockRecorder) ExpandPersistentVolumeClaim(ctx, namespace, cl
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpandPersistentVolumeClaim", reflect.TypeOf((*MockClient)(nil).ExpandPersistentVolumeClaim), ctx, namespace, claimName, size)
 }
 
+// GetActiveMigration mocks base method.
+func (m *MockClient) GetActiveMigration(ctx context.Context, namespace, vmiName string) (*v11.VirtualMachineInstanceMigration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetActiveMigration", ctx, namespace, vmiName)
+	ret0, _ := ret[0].(*v11.VirtualMachineInstanceMigration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetActiveMigration indicates an expected call of GetActiveMigration.
+func (mr *MockClientMockRecorder) GetActiveMigration(ctx, namespace, vmiName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetActiveMigration", reflect.TypeOf((*MockClient)(nil).GetActiveMigration), ctx, namespace, vmiName)
+}
+
 // GetDataVolume mocks base method.
 func (m *MockClient) GetDataVolume(ctx context.Context, namespace, name string) (*v1beta1.DataVolume, error) {
 	m.ctrl.T.Helper()
@@ -271,6 +300,21 @@ func (mr *MockClientMockRecorder) ListVirtualMachines(ctx, namespace interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListVirtualMachines", reflect.TypeOf((*MockClient)(nil).ListVirtualMachines), ctx, namespace)
 }
 
+// ListVirtualMachinesWithVolume mocks base method.
+func (m *MockClient) ListVirtualMachinesWithVolume(ctx context.Context, namespace, volumeName string) ([]v11.VirtualMachineInstance, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListVirtualMachinesWithVolume", ctx, namespace, volumeName)
+	ret0, _ := ret[0].([]v11.VirtualMachineInstance)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListVirtualMachinesWithVolume indicates an expected call of ListVirtualMachinesWithVolume.
+func (mr *MockClientMockRecorder) ListVirtualMachinesWithVolume(ctx, namespace, volumeName interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListVirtualMachinesWithVolume", reflect.TypeOf((*MockClient)(nil).ListVirtualMachinesWithVolume), ctx, namespace, volumeName)
+}
+
 // ListVolumeSnapshots mocks base method.
 func (m *MockClient) ListVolumeSnapshots(ctx context.Context, namespace string) (*v1.VolumeSnapshotList, error) {
 	m.ctrl.T.Helper()
@@ -327,3 +371,17 @@ func (mr *MockClientMockRecorder) RemoveVolumeFromVMI(ctx, namespace, vmName, ho
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveVolumeFromVMI", reflect.TypeOf((*MockClient)(nil).RemoveVolumeFromVMI), ctx, namespace, vmName, hotPlugRequest)
 }
+
+// StartInformers mocks base method.
+func (m *MockClient) StartInformers(ctx context.Context, namespace string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartInformers", ctx, namespace)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StartInformers indicates an expected call of StartInformers.
+func (mr *MockClientMockRecorder) StartInformers(ctx, namespace interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartInformers", reflect.TypeOf((*MockClient)(nil).StartInformers), ctx, namespace)
+}
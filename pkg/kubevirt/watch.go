@@ -0,0 +1,165 @@
+package kubevirt
+
+import (
+	"context"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/klog/v2"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+// rewatchInterval is the pause before listing again after the server closed a watch.
+const rewatchInterval = time.Second
+
+type listFunc func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error)
+type watchFunc func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+
+// waitFor lists the object called name, and then watches it from the resourceVersion of the list until condition
+// returns true, condition returns an error or ctx is done. condition is called with a nil object while the object
+// does not exist. When the server closes the watch the object is listed again, so no change is missed.
+func waitFor[T runtime.Object](ctx context.Context, name string, list listFunc, watchObj watchFunc, condition func(obj T) (bool, error)) error {
+	opts := metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String()}
+	for {
+		objList, err := list(ctx, opts)
+		if err != nil {
+			return err
+		}
+		obj, err := findByName[T](objList, name)
+		if err != nil {
+			return err
+		}
+		if done, err := condition(obj); done || err != nil {
+			return err
+		}
+
+		listMeta, err := meta.ListAccessor(objList)
+		if err != nil {
+			return err
+		}
+		watchOpts := opts
+		watchOpts.ResourceVersion = listMeta.GetResourceVersion()
+		watchOpts.AllowWatchBookmarks = true
+		w, err := watchObj(ctx, watchOpts)
+		if err != nil {
+			return err
+		}
+		done, err := consumeEvents(ctx, w, name, condition)
+		w.Stop()
+		if done || err != nil {
+			return err
+		}
+
+		klog.V(5).Infof("Watch on %s closed, listing again", name)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rewatchInterval):
+		}
+	}
+}
+
+// consumeEvents feeds the events of w to condition. It returns false without an error when the watch has to be
+// restarted.
+func consumeEvents[T runtime.Object](ctx context.Context, w watch.Interface, name string, condition func(obj T) (bool, error)) (bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			var obj T
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				typed, ok := event.Object.(T)
+				if !ok {
+					continue
+				}
+				// Fake clients don't honor field selectors.
+				if accessor, err := meta.Accessor(typed); err != nil || accessor.GetName() != name {
+					continue
+				}
+				obj = typed
+			case watch.Deleted:
+				if accessor, err := meta.Accessor(event.Object); err != nil || accessor.GetName() != name {
+					continue
+				}
+			case watch.Error:
+				// Most likely the resourceVersion expired, start over with a fresh list.
+				klog.V(5).Infof("Watch on %s failed: %v", name, event.Object)
+				return false, nil
+			default:
+				continue
+			}
+			if done, err := condition(obj); done || err != nil {
+				return done, err
+			}
+		}
+	}
+}
+
+func findByName[T runtime.Object](list runtime.Object, name string) (T, error) {
+	var result T
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return result, err
+	}
+	for _, item := range items {
+		typed, ok := item.(T)
+		if !ok {
+			continue
+		}
+		if accessor, err := meta.Accessor(typed); err == nil && accessor.GetName() == name {
+			return typed, nil
+		}
+	}
+	return result, nil
+}
+
+func (c *client) waitForVirtualMachineInstance(ctx context.Context, namespace, name string, condition func(vmi *kubevirtv1.VirtualMachineInstance) (bool, error)) error {
+	vmis := c.virtClient.KubevirtV1().VirtualMachineInstances(namespace)
+	return waitFor(ctx, name,
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return vmis.List(ctx, opts)
+		},
+		vmis.Watch,
+		condition)
+}
+
+func (c *client) waitForVirtualMachine(ctx context.Context, namespace, name string, condition func(vm *kubevirtv1.VirtualMachine) (bool, error)) error {
+	vms := c.virtClient.KubevirtV1().VirtualMachines(namespace)
+	return waitFor(ctx, name,
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return vms.List(ctx, opts)
+		},
+		vms.Watch,
+		condition)
+}
+
+func (c *client) waitForVolumeSnapshot(ctx context.Context, namespace, name string, condition func(snapshot *snapshotv1.VolumeSnapshot) (bool, error)) error {
+	snapshots := c.infraSnapClient.SnapshotV1().VolumeSnapshots(namespace)
+	return waitFor(ctx, name,
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return snapshots.List(ctx, opts)
+		},
+		snapshots.Watch,
+		condition)
+}
+
+func (c *client) waitForPersistentVolume(ctx context.Context, name string, condition func(pv *k8sv1.PersistentVolume) (bool, error)) error {
+	pvs := c.infraKubernetesClient.CoreV1().PersistentVolumes()
+	return waitFor(ctx, name,
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return pvs.List(ctx, opts)
+		},
+		pvs.Watch,
+		condition)
+}
@@ -24,6 +24,7 @@ type Mounter interface {
 	IsBlockDevice(fullPath string) (bool, error)
 	GetBlockSizeBytes(devicePath string) (int64, error)
 	GetVolumeStats(volumePath string) (VolumeStats, error)
+	BindRemount(target string, options []string) error
 }
 
 // NodeMounter implements Mounter.
@@ -55,6 +56,17 @@ func (nm *NodeMounter) IsBlockDevice(fullPath string) (bool, error) {
 	return (st.Mode & unix.S_IFMT) == unix.S_IFBLK, nil
 }
 
+// BindRemount changes the options of the bind mount at target in place. Mount can't do that, it bind mounts the
+// source again before it applies the options of a bind mount.
+func (nm *NodeMounter) BindRemount(target string, options []string) error {
+	args := []string{"-o", strings.Join(append([]string{"remount", "bind"}, options...), ","), target}
+	output, err := nm.Exec.Command("mount", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mount %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
 func (nm *NodeMounter) GetBlockSizeBytes(devicePath string) (int64, error) {
 	output, err := nm.Exec.Command("blockdev", "--getsize64", devicePath).Output()
 	if err != nil {
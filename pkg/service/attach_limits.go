@@ -0,0 +1,81 @@
+package service
+
+import (
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+// defaultMaxHotplugVolumes is the number of volumes that can be hotplugged into a VM per disk bus. Every virtio disk
+// needs a spare PCIe root port of the VM, of which there are only a few, while the virtio-scsi controller of the VM
+// addresses many more LUNs.
+var defaultMaxHotplugVolumes = map[kubevirtv1.DiskBus]int64{
+	kubevirtv1.DiskBusSCSI:   64,
+	kubevirtv1.DiskBusVirtio: 14,
+}
+
+// maxHotplugVolumes returns the configured attach limit if there is one, or the default limit of bus.
+func maxHotplugVolumes(configured int64, bus kubevirtv1.DiskBus) int64 {
+	if configured > 0 {
+		return configured
+	}
+	if limit, ok := defaultMaxHotplugVolumes[bus]; ok {
+		return limit
+	}
+	return defaultMaxHotplugVolumes[busDefaultValue]
+}
+
+// nodeMaxHotplugVolumes returns the attach limit the node reports to the scheduler: the configured limit if there is
+// one, or the smallest default limit of the buses. The node doesn't know the buses of the volumes that will be
+// published to it, and reporting a bigger limit than the controller enforces makes pods fail after scheduling.
+func nodeMaxHotplugVolumes(configured int64) int64 {
+	if configured > 0 {
+		return configured
+	}
+	var limit int64
+	for _, busLimit := range defaultMaxHotplugVolumes {
+		if limit == 0 || busLimit < limit {
+			limit = busLimit
+		}
+	}
+	return limit
+}
+
+// countHotplugVolumes returns how many of the volumes hotplugged into a VM or VMI with spec are disks on bus. Volumes
+// that requests add to a VM, and that KubeVirt hasn't added to its spec yet, are counted as well.
+func countHotplugVolumes(spec *kubevirtv1.VirtualMachineInstanceSpec, requests []kubevirtv1.VirtualMachineVolumeRequest, bus kubevirtv1.DiskBus) int64 {
+	diskBuses := map[string]kubevirtv1.DiskBus{}
+	for _, disk := range spec.Domain.Devices.Disks {
+		if disk.Disk != nil {
+			diskBuses[disk.Name] = disk.Disk.Bus
+		}
+	}
+
+	var count int64
+	volumes := map[string]bool{}
+	for _, volume := range spec.Volumes {
+		volumes[volume.Name] = true
+		hotplugged := (volume.DataVolume != nil && volume.DataVolume.Hotpluggable) ||
+			(volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.Hotpluggable)
+		if hotplugged && diskBuses[volume.Name] == bus {
+			count++
+		}
+	}
+	for _, request := range requests {
+		if request.AddVolumeOptions == nil || volumes[request.AddVolumeOptions.Name] {
+			continue
+		}
+		if disk := request.AddVolumeOptions.Disk; disk != nil && disk.Disk != nil && disk.Disk.Bus == bus {
+			count++
+		}
+	}
+	return count
+}
+
+// hasAddVolumeRequest returns true when requests already add the volume name to a VM.
+func hasAddVolumeRequest(requests []kubevirtv1.VirtualMachineVolumeRequest, name string) bool {
+	for _, request := range requests {
+		if request.AddVolumeOptions != nil && request.AddVolumeOptions.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -3,8 +3,8 @@ package service
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strconv"
-	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
@@ -18,6 +18,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
 
@@ -29,6 +30,8 @@ const (
 	busParameter    = "bus"
 	busDefaultValue = kubevirtv1.DiskBus("scsi")
 	serialParameter = "serial"
+	// encryptedParameter enables LUKS encryption of the volume on the tenant node.
+	encryptedParameter = "encrypted"
 
 	ErrVolumeAttachedMessage = "volume is attached to another VM"
 )
@@ -44,6 +47,13 @@ type ControllerService struct {
 	infraClusterNamespace   string
 	infraClusterLabels      map[string]string
 	storageClassEnforcement util.StorageClassEnforcement
+	// allowedNamespaces are the namespaces besides infraClusterNamespace whose VMs volumes can be attached to.
+	allowedNamespaces []string
+	vmOwnership       VMOwnership
+	timeouts          ControllerTimeouts
+	// maxVolumesPerNode overrides the per bus limit of hotplugged volumes when set.
+	maxVolumesPerNode int64
+	hotplug           hotplugQueue
 }
 
 // NewControllerService creates a new instance of ControllerService.
@@ -52,12 +62,20 @@ func NewControllerService(
 	infraClusterNamespace string,
 	infraClusterLabels map[string]string,
 	storageClassEnforcement util.StorageClassEnforcement,
+	allowedNamespaces []string,
+	vmOwnership VMOwnership,
+	timeouts ControllerTimeouts,
+	maxVolumesPerNode int64,
 ) *ControllerService {
 	return &ControllerService{
 		virtClient:              virtClient,
 		infraClusterNamespace:   infraClusterNamespace,
 		infraClusterLabels:      infraClusterLabels,
 		storageClassEnforcement: storageClassEnforcement,
+		allowedNamespaces:       allowedNamespaces,
+		vmOwnership:             vmOwnership,
+		timeouts:                timeouts,
+		maxVolumesPerNode:       maxVolumesPerNode,
 	}
 }
 
@@ -170,6 +188,13 @@ func (c *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 	storageClassName := req.Parameters[client.InfraStorageClassNameParameter]
 	storageSize := req.GetCapacityRange().GetRequiredBytes()
 	dvName := req.Name
+	dvNamespace := c.infraClusterNamespace
+	if namespace := req.Parameters[infraNamespaceParameter]; namespace != "" {
+		if err := c.checkInfraNamespace(namespace); err != nil {
+			return nil, err
+		}
+		dvNamespace = namespace
+	}
 	value, ok := req.Parameters[busParameter]
 	var bus kubevirtv1.DiskBus
 	if ok {
@@ -177,6 +202,25 @@ func (c *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 	} else {
 		bus = busDefaultValue
 	}
+	encrypted := false
+	if value, ok := req.Parameters[encryptedParameter]; ok {
+		encrypted, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid value %q for parameter %s", value, encryptedParameter)
+		}
+	}
+	mkfsOptions := req.Parameters[mkfsOptionsParameter]
+	if err := validateMkfsOptions(req.GetVolumeCapabilities(), mkfsOptions); err != nil {
+		return nil, err
+	}
+	checkPolicy, err := fsckPolicy(req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	discard, err := discardMode(req.Parameters)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create DataVolume object
 	source, err := c.determineDvSource(ctx, req)
@@ -199,7 +243,7 @@ func (c *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 		},
 		ObjectMeta: v1.ObjectMeta{
 			Name:      dvName,
-			Namespace: c.infraClusterNamespace,
+			Namespace: dvNamespace,
 			Labels:    c.infraClusterLabels,
 			Annotations: map[string]string{
 				"cdi.kubevirt.io/storage.deleteAfterCompletion": "false",
@@ -224,6 +268,12 @@ func (c *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 		}
 	}
 
+	if discard != discardNone {
+		// KubeVirt configures the disks of volumes that aren't preallocated with discard=unmap, so the discards of
+		// the guest reach the infra storage.
+		dv.Spec.Preallocation = ptr.To(false)
+	}
+
 	if isRWX {
 		dv.Spec.Storage.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
 	}
@@ -235,10 +285,10 @@ func (c *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 		dv.Spec.Storage.StorageClassName = &storageClassName
 	}
 
-	if existingDv, err := c.virtClient.GetDataVolume(ctx, c.infraClusterNamespace, dvName); errors.IsNotFound(err) {
+	if existingDv, err := c.virtClient.GetDataVolume(ctx, dvNamespace, dvName); errors.IsNotFound(err) {
 		// Create DataVolume
-		klog.Infof("creating new DataVolume %s/%s", c.infraClusterNamespace, req.Name)
-		dv, err = c.virtClient.CreateDataVolume(ctx, c.infraClusterNamespace, dv)
+		klog.Infof("creating new DataVolume %s/%s", dvNamespace, req.Name)
+		dv, err = c.virtClient.CreateDataVolume(ctx, dvNamespace, dv)
 		if err != nil {
 			klog.Error("failed creating DataVolume " + dvName)
 			return nil, err
@@ -260,15 +310,35 @@ func (c *ControllerService) CreateVolume(ctx context.Context, req *csi.CreateVol
 	// Prepare serial for disk
 	serial := string(dv.GetUID())
 
+	volumeContext := map[string]string{
+		busParameter:    string(bus),
+		serialParameter: serial,
+	}
+	if encrypted {
+		volumeContext[encryptedParameter] = "true"
+	}
+	if mkfsOptions != "" {
+		volumeContext[mkfsOptionsParameter] = mkfsOptions
+	}
+	if checkPolicy != fsckPolicyNone {
+		volumeContext[fsckPolicyParameter] = checkPolicy
+	}
+	if discard != discardNone {
+		volumeContext[discardParameter] = discard
+	}
+	switch req.GetVolumeContentSource().GetType().(type) {
+	case *csi.VolumeContentSource_Snapshot:
+		volumeContext[contentSourceParameter] = contentSourceSnapshot
+	case *csi.VolumeContentSource_Volume:
+		volumeContext[contentSourceParameter] = contentSourceVolume
+	}
+
 	// Return response
 	return &csi.CreateVolumeResponse{
 		Volume: &csi.Volume{
 			CapacityBytes: storageSize,
-			VolumeId:      dvName,
-			VolumeContext: map[string]string{
-				busParameter:    string(bus),
-				serialParameter: serial,
-			},
+			VolumeId:      c.infraObjectID(dvNamespace, dvName),
+			VolumeContext: volumeContext,
 			ContentSource: req.GetVolumeContentSource(),
 		},
 	}, nil
@@ -280,7 +350,11 @@ func (c *ControllerService) determineDvSource(ctx context.Context, req *csi.Crea
 		source := req.GetVolumeContentSource()
 		switch source.Type.(type) {
 		case *csi.VolumeContentSource_Snapshot:
-			if snapshot, err := c.virtClient.GetVolumeSnapshot(ctx, c.infraClusterNamespace, source.GetSnapshot().GetSnapshotId()); errors.IsNotFound(err) {
+			snapshotNamespace, snapshotName, err := c.splitInfraObjectID(source.GetSnapshot().GetSnapshotId())
+			if err != nil {
+				return nil, err
+			}
+			if snapshot, err := c.virtClient.GetVolumeSnapshot(ctx, snapshotNamespace, snapshotName); errors.IsNotFound(err) {
 				return nil, status.Errorf(codes.NotFound, "source snapshot content %s not found", source.GetSnapshot().GetSnapshotId())
 			} else if err != nil {
 				return nil, err
@@ -288,12 +362,16 @@ func (c *ControllerService) determineDvSource(ctx context.Context, req *csi.Crea
 				if snapshotSource := source.GetSnapshot(); snapshotSource != nil {
 					res.Snapshot = &cdiv1.DataVolumeSourceSnapshot{
 						Name:      snapshot.Name,
-						Namespace: c.infraClusterNamespace,
+						Namespace: snapshotNamespace,
 					}
 				}
 			}
 		case *csi.VolumeContentSource_Volume:
-			if volume, err := c.virtClient.GetDataVolume(ctx, c.infraClusterNamespace, source.GetVolume().GetVolumeId()); errors.IsNotFound(err) {
+			volumeNamespace, volumeName, err := c.splitInfraObjectID(source.GetVolume().GetVolumeId())
+			if err != nil {
+				return nil, err
+			}
+			if volume, err := c.virtClient.GetDataVolume(ctx, volumeNamespace, volumeName); errors.IsNotFound(err) {
 				return nil, status.Errorf(codes.NotFound, "source volume content %s not found", source.GetVolume().GetVolumeId())
 			} else if err != nil {
 				return nil, err
@@ -301,7 +379,7 @@ func (c *ControllerService) determineDvSource(ctx context.Context, req *csi.Crea
 				if volumeSource := source.GetVolume(); volumeSource != nil {
 					res.PVC = &cdiv1.DataVolumeSourcePVC{
 						Name:      volume.Name,
-						Namespace: c.infraClusterNamespace,
+						Namespace: volumeNamespace,
 					}
 				}
 			}
@@ -333,10 +411,13 @@ func (c *ControllerService) DeleteVolume(ctx context.Context, req *csi.DeleteVol
 	if err := c.validateDeleteVolumeRequest(req); err != nil {
 		return nil, err
 	}
-	dvName := req.VolumeId
+	dvNamespace, dvName, err := c.splitInfraObjectID(req.VolumeId)
+	if err != nil {
+		return nil, err
+	}
 	klog.V(3).Infof("Removing data volume with %s", dvName)
 
-	err := c.virtClient.DeleteDataVolume(ctx, c.infraClusterNamespace, dvName)
+	err = c.virtClient.DeleteDataVolume(ctx, dvNamespace, dvName)
 	if err != nil {
 		klog.Error("failed deleting DataVolume " + dvName)
 		return nil, err
@@ -369,14 +450,19 @@ func (c *ControllerService) ControllerPublishVolume(
 		return nil, err
 	}
 
-	dvName := req.GetVolumeId()
+	dvNamespace, dvName, err := c.splitInfraObjectID(req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
 
-	// Get VM name from node ID which is a namespace/name
-	_, vmName, err := cache.SplitMetaNamespaceKey(req.NodeId)
+	vmNamespace, vmName, err := c.vmFromNodeID(req.NodeId)
 	if err != nil {
-		klog.Error("failed getting VM Name for node ID " + req.NodeId)
 		return nil, err
 	}
+	// KubeVirt only hot-plugs volumes from the namespace of the VM.
+	if dvNamespace != vmNamespace {
+		return nil, status.Errorf(codes.FailedPrecondition, "volume %s is in namespace %s, it can't be attached to node %s in namespace %s", req.GetVolumeId(), dvNamespace, req.NodeId, vmNamespace)
+	}
 
 	// Check if the volume is RWO, and if it is, check if its in a different Virtual Machine Instance.
 	isRWX, err := hasRWXCapabiltyAccessMode(req.GetVolumeCapability().GetAccessMode())
@@ -384,7 +470,7 @@ func (c *ControllerService) ControllerPublishVolume(
 		return nil, fmt.Errorf("error checking access mode: %w", err)
 	}
 	if !isRWX {
-		alreadyAttached, err := c.IsVolumeAttachedToOtherVMI(ctx, dvName, c.infraClusterNamespace, vmName)
+		alreadyAttached, err := c.IsVolumeAttachedToOtherVMI(ctx, dvName, vmNamespace, vmName)
 		if err != nil {
 			return nil, status.Errorf(codes.FailedPrecondition, "failed to check if volume is already attached: %s", err)
 		}
@@ -393,7 +479,7 @@ func (c *ControllerService) ControllerPublishVolume(
 		}
 	}
 
-	if _, err := c.virtClient.GetDataVolume(ctx, c.infraClusterNamespace, dvName); errors.IsNotFound(err) {
+	if _, err := c.virtClient.GetDataVolume(ctx, dvNamespace, dvName); errors.IsNotFound(err) {
 		return nil, status.Errorf(codes.NotFound, "volume %s not found", req.GetVolumeId())
 	} else if err != nil {
 		return nil, err
@@ -401,12 +487,27 @@ func (c *ControllerService) ControllerPublishVolume(
 
 	klog.V(3).Infof("Attaching DataVolume %s to Node ID %s", dvName, req.NodeId)
 
-	_, err = c.virtClient.GetWorkloadManagingVirtualMachine(ctx, c.infraClusterNamespace, vmName)
-	if err != nil {
-		if !errors.IsNotFound(err) {
+	// Standalone VMIs and members of VMI replica sets have no VM, their volumes are hot-plugged into the VMI.
+	standalone := false
+	var target v1.Object
+	vm, err := c.virtClient.GetWorkloadManagingVirtualMachine(ctx, vmNamespace, vmName)
+	switch {
+	case err == nil:
+		target = vm
+	case errors.IsNotFound(err):
+		vmi, err := c.virtClient.GetVirtualMachine(ctx, vmNamespace, vmName)
+		if errors.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "vm %s not found", vmName)
+		} else if err != nil {
 			return nil, err
 		}
-		return nil, status.Errorf(codes.NotFound, "vm %s not found", vmName)
+		standalone = true
+		target = vmi
+	default:
+		return nil, err
+	}
+	if err := c.checkVMOwnership(target); err != nil {
+		return nil, err
 	}
 
 	// Determine serial number/string for the new disk
@@ -415,17 +516,39 @@ func (c *ControllerService) ControllerPublishVolume(
 	// Determine BUS type
 	bus := req.VolumeContext[busParameter]
 
-	// Fast-path: nothing to do if the volume is already attached
-	attached, err := c.virtClient.EnsureVolumeAvailableVM(ctx, c.infraClusterNamespace, vmName, dvName)
+	// Fast-path: no hot-plug if the volume is already attached. It may have been attached before the VM migrated, so
+	// still wait for it to be ready on the node the VMI runs on now.
+	var attached bool
+	if standalone {
+		_, attached, err = c.isVolumeAttachedToVMI(ctx, dvName, vmNamespace, vmName)
+	} else {
+		attached, err = c.virtClient.EnsureVolumeAvailableVM(ctx, vmNamespace, vmName, dvName)
+	}
 	if err != nil {
 		return nil, err
 	}
 	if attached {
 		klog.V(3).Infof("Volume %s already attached to VM %s - skipping hot-plug", dvName, vmName)
-		return &csi.ControllerPublishVolumeResponse{}, nil
+	} else if err := c.hotplugVolume(ctx, dvName, vmNamespace, vmName, serial, bus, standalone); err != nil {
+		return nil, err
 	}
 
-	// hotplug DataVolume to VM
+	// The wait is bounded by the deadline of the request, so running out of time returns DeadlineExceeded and the
+	// csi-attacher retries instead of failing the attachment. It also lasts until a migration of the VM is done, the
+	// volume status only counts once the volume is ready on the target node.
+	timeout := boundedTimeout(ctx, c.timeouts.hotplug())
+	err = c.virtClient.EnsureVolumeAvailable(ctx, vmNamespace, vmName, dvName, timeout)
+	if err != nil {
+		klog.Errorf("volume %s failed to be ready in time (%v) in VM %s, %v", dvName, timeout, vmName, err)
+		return nil, waitError(err, "volume %s is not ready in VM %s", dvName, vmName)
+	}
+
+	klog.V(3).Infof("Successfully attached volume %s to VM %s", dvName, vmName)
+	return &csi.ControllerPublishVolumeResponse{}, nil
+}
+
+// hotplugVolume adds the DataVolume to the VM, or to the VMI if it is standalone, retrying failed calls.
+func (c *ControllerService) hotplugVolume(ctx context.Context, dvName, vmNamespace, vmName, serial, bus string, standalone bool) error {
 	klog.V(3).Infof("Start attaching DataVolume %s to VM %s. Volume name: %s. Serial: %s. Bus: %s", dvName, vmName, dvName, serial, bus)
 
 	addVolumeOptions := &kubevirtv1.AddVolumeOptions{
@@ -445,60 +568,107 @@ func (c *ControllerService) ControllerPublishVolume(
 		},
 	}
 
-	if err := wait.ExponentialBackoff(wait.Backoff{
-		Duration: time.Second,
-		Steps:    5,
-		Factor:   2,
-		Cap:      time.Second * 30,
-	}, func() (bool, error) {
-		if err := c.addVolumeToVm(ctx, dvName, vmName, addVolumeOptions); err != nil {
+	if err := wait.ExponentialBackoffWithContext(ctx, c.timeouts.hotplugBackoff(), func(ctx context.Context) (bool, error) {
+		if err := c.hotplug.do(ctx, vmKey(vmNamespace, vmName), hotplugAdd, dvName, func(ctx context.Context) error {
+			if standalone {
+				return c.addVolumeToVmi(ctx, dvName, vmNamespace, vmName, addVolumeOptions)
+			}
+			return c.addVolumeToVm(ctx, dvName, vmNamespace, vmName, addVolumeOptions)
+		}); err != nil {
+			if isTerminalHotplugError(err) {
+				return false, err
+			}
 			klog.Infof("failed adding volume %s to VM %s, retrying, err: %v", dvName, vmName, err)
 			return false, nil
 		}
 		return true, nil
 	}); err != nil {
-		return nil, err
+		return waitError(err, "failed adding volume %s to VM %s", dvName, vmName)
 	}
+	return nil
+}
 
-	// Ensure that the csi-attacher and csi-provisioner --timeout values are > the timeout specified here so we don't get
-	// odd failures with detaching volumes.
-	err = c.virtClient.EnsureVolumeAvailable(ctx, c.infraClusterNamespace, vmName, dvName, time.Minute*2)
+// checkNotMigrating returns Unavailable while the VM is live migrating. Hot-plugging during a migration conflicts
+// with KubeVirt moving the volumes to the target node, so the sidecars should retry once the migration is done.
+func (c *ControllerService) checkNotMigrating(ctx context.Context, vmNamespace, vmName string) error {
+	migration, err := c.virtClient.GetActiveMigration(ctx, vmNamespace, vmName)
 	if err != nil {
-		klog.Errorf("volume %s failed to be ready in time (2m) in VM %s, %v", dvName, vmName, err)
-		return nil, err
+		return err
+	}
+	if migration != nil {
+		return status.Errorf(codes.Unavailable, "VM %s is being migrated by %s", vmName, migration.Name)
 	}
+	return nil
+}
 
-	klog.V(3).Infof("Successfully attached volume %s to VM %s", dvName, vmName)
-	return &csi.ControllerPublishVolumeResponse{}, nil
+// isTerminalHotplugError returns true for hot-plug errors that retrying right away won't fix.
+func isTerminalHotplugError(err error) bool {
+	switch status.Code(err) {
+	case codes.ResourceExhausted, codes.Unavailable:
+		return true
+	}
+	return false
 }
 
-func (c *ControllerService) isVolumeAttached(ctx context.Context, dvName, vmName string) (bool, error) {
-	vm, err := c.virtClient.GetWorkloadManagingVirtualMachine(ctx, c.infraClusterNamespace, vmName)
+func (c *ControllerService) isVolumeAttached(ctx context.Context, dvName, vmNamespace, vmName string) (*kubevirtv1.VirtualMachine, bool, error) {
+	vm, err := c.virtClient.GetWorkloadManagingVirtualMachine(ctx, vmNamespace, vmName)
 	if err != nil {
 		if !errors.IsNotFound(err) {
-			return false, err
+			return nil, false, err
 		}
-		return false, status.Errorf(codes.NotFound, "vm %s not found", vmName)
+		return nil, false, status.Errorf(codes.NotFound, "vm %s not found", vmName)
 	}
 	for _, volume := range vm.Spec.Template.Spec.Volumes {
 		if volume.DataVolume == nil {
 			continue
 		}
 		if volume.DataVolume.Hotpluggable && volume.Name == dvName {
-			return true, nil
+			return vm, true, nil
 		}
 	}
 
-	return false, nil
+	return vm, false, nil
+}
+
+// vmKey identifies the VM in the hotplug queue.
+func vmKey(vmNamespace, vmName string) string {
+	return vmNamespace + "/" + vmName
+}
+
+// vmFromNodeID returns the namespace and name of the VM of a node. Node IDs are namespace/name, VMs outside the infra
+// cluster namespace can only be used when their namespace is allowed.
+func (c *ControllerService) vmFromNodeID(nodeID string) (string, string, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(nodeID)
+	if err != nil {
+		klog.Error("failed getting VM Name for node ID " + nodeID)
+		return "", "", err
+	}
+	if namespace == "" {
+		namespace = c.infraClusterNamespace
+	}
+	if namespace != c.infraClusterNamespace && !slices.Contains(c.allowedNamespaces, namespace) {
+		return "", "", status.Errorf(codes.InvalidArgument, "namespace %s of node %s is not an allowed infra cluster namespace", namespace, nodeID)
+	}
+	return namespace, name, nil
 }
 
-func (c *ControllerService) addVolumeToVm(ctx context.Context, dvName, vmName string, addVolumeOptions *kubevirtv1.AddVolumeOptions) error {
-	volumeFound, err := c.isVolumeAttached(ctx, dvName, vmName)
+// addVolumeToVm adds the volume to the VM unless it has it already. It runs in the hotplug queue of the VM and reads
+// the VM from the API server, so it sees the volumes the operations before it added.
+func (c *ControllerService) addVolumeToVm(ctx context.Context, dvName, vmNamespace, vmName string, addVolumeOptions *kubevirtv1.AddVolumeOptions) error {
+	ctx = client.WithLiveReads(ctx)
+	vm, volumeFound, err := c.isVolumeAttached(ctx, dvName, vmNamespace, vmName)
 	if err != nil {
 		return err
 	}
-	if !volumeFound {
-		err = c.virtClient.AddVolumeToVM(ctx, c.infraClusterNamespace, vmName, addVolumeOptions)
+	if !volumeFound && !hasAddVolumeRequest(vm.Status.VolumeRequests, dvName) {
+		var spec *kubevirtv1.VirtualMachineInstanceSpec
+		if vm.Spec.Template != nil {
+			spec = &vm.Spec.Template.Spec
+		}
+		if err := c.checkCanHotplug(ctx, vmNamespace, vmName, spec, vm.Status.VolumeRequests, addVolumeOptions); err != nil {
+			return err
+		}
+		err = c.virtClient.AddVolumeToVM(ctx, vmNamespace, vmName, addVolumeOptions)
 		if err != nil {
 			return err
 		}
@@ -506,6 +676,57 @@ func (c *ControllerService) addVolumeToVm(ctx context.Context, dvName, vmName st
 	return nil
 }
 
+// isVolumeAttachedToVMI returns true when the DataVolume is hot-plugged into the spec of the VMI.
+func (c *ControllerService) isVolumeAttachedToVMI(ctx context.Context, dvName, vmiNamespace, vmiName string) (*kubevirtv1.VirtualMachineInstance, bool, error) {
+	vmi, err := c.virtClient.GetVirtualMachine(ctx, vmiNamespace, vmiName)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, false, err
+		}
+		return nil, false, status.Errorf(codes.NotFound, "vmi %s not found", vmiName)
+	}
+	for _, volume := range vmi.Spec.Volumes {
+		if volume.DataVolume != nil && volume.DataVolume.Hotpluggable && volume.Name == dvName {
+			return vmi, true, nil
+		}
+	}
+	return vmi, false, nil
+}
+
+// addVolumeToVmi adds the volume to a VMI without a VM unless it has it already, reading the VMI from the API server
+// like addVolumeToVm.
+func (c *ControllerService) addVolumeToVmi(ctx context.Context, dvName, vmiNamespace, vmiName string, addVolumeOptions *kubevirtv1.AddVolumeOptions) error {
+	ctx = client.WithLiveReads(ctx)
+	vmi, volumeFound, err := c.isVolumeAttachedToVMI(ctx, dvName, vmiNamespace, vmiName)
+	if err != nil {
+		return err
+	}
+	if volumeFound {
+		return nil
+	}
+	if err := c.checkCanHotplug(ctx, vmiNamespace, vmiName, &vmi.Spec, nil, addVolumeOptions); err != nil {
+		return err
+	}
+	return c.virtClient.AddVolumeToVMI(ctx, vmiNamespace, vmiName, addVolumeOptions)
+}
+
+// checkCanHotplug returns an error when the volume can't be hot-plugged right now, because the VM is migrating or
+// already has as many volumes on the bus as allowed, counting the volumes of spec and the pending add requests.
+func (c *ControllerService) checkCanHotplug(ctx context.Context, vmNamespace, vmName string, spec *kubevirtv1.VirtualMachineInstanceSpec, requests []kubevirtv1.VirtualMachineVolumeRequest, addVolumeOptions *kubevirtv1.AddVolumeOptions) error {
+	if err := c.checkNotMigrating(ctx, vmNamespace, vmName); err != nil {
+		return err
+	}
+	if spec == nil {
+		return nil
+	}
+	bus := addVolumeOptions.Disk.DiskDevice.Disk.Bus
+	limit := maxHotplugVolumes(c.maxVolumesPerNode, bus)
+	if count := countHotplugVolumes(spec, requests, bus); count >= limit {
+		return status.Errorf(codes.ResourceExhausted, "VM %s already has %d of %d volumes on bus %s hotplugged", vmName, count, limit, bus)
+	}
+	return nil
+}
+
 func (c *ControllerService) validateControllerUnpublishVolumeRequest(req *csi.ControllerUnpublishVolumeRequest) error {
 	if req == nil {
 		return status.Error(codes.InvalidArgument, "missing request")
@@ -525,13 +746,14 @@ func (c *ControllerService) ControllerUnpublishVolume(ctx context.Context, req *
 	if err := c.validateControllerUnpublishVolumeRequest(req); err != nil {
 		return nil, err
 	}
-	dvName := req.VolumeId
+	_, dvName, err := c.splitInfraObjectID(req.VolumeId)
+	if err != nil {
+		return nil, err
+	}
 	klog.V(3).Infof("Detaching DataVolume %s from Node ID %s", dvName, req.NodeId)
 
-	// Get VM name from node ID which is a namespace/name
-	_, vmName, err := cache.SplitMetaNamespaceKey(req.NodeId)
+	vmNamespace, vmName, err := c.vmFromNodeID(req.NodeId)
 	if err != nil {
-		klog.Error("failed getting VM Name for node ID " + req.NodeId)
 		return nil, err
 	}
 	// We do NOT short-circuit on "VM not found" anymore. The VMI (and its
@@ -539,7 +761,7 @@ func (c *ControllerService) ControllerUnpublishVolume(ctx context.Context, req *
 	// race; returning success here used to leave orphan hot-plug pods
 	// that hold the infra storage device exclusively attached to the source
 	// host — blocking subsequent attachments. See kubevirt/csi-driver#83.
-	attached, err := c.volumeStillAttached(ctx, vmName, dvName)
+	attached, err := c.volumeStillAttached(ctx, vmNamespace, vmName, dvName)
 	if err != nil {
 		return nil, err
 	}
@@ -548,25 +770,26 @@ func (c *ControllerService) ControllerUnpublishVolume(ctx context.Context, req *
 		return &csi.ControllerUnpublishVolumeResponse{}, nil
 	}
 
-	if err := wait.ExponentialBackoff(wait.Backoff{
-		Duration: time.Second,
-		Steps:    5,
-		Factor:   2,
-		Cap:      time.Second * 30,
-	}, func() (bool, error) {
-		if err := c.removeVolumeFromVm(ctx, dvName, vmName); err != nil {
+	if err := wait.ExponentialBackoffWithContext(ctx, c.timeouts.hotplugBackoff(), func(ctx context.Context) (bool, error) {
+		if err := c.hotplug.do(ctx, vmKey(vmNamespace, vmName), hotplugRemove, dvName, func(ctx context.Context) error {
+			return c.removeVolumeFromVm(ctx, dvName, vmNamespace, vmName)
+		}); err != nil {
+			if isTerminalHotplugError(err) {
+				return false, err
+			}
 			klog.Infof("failed removing volume %s from VM %s, err: %v", dvName, vmName, err)
 			return false, nil
 		}
 		return true, nil
 	}); err != nil {
-		return nil, err
+		return nil, waitError(err, "failed removing volume %s from VM %s", dvName, vmName)
 	}
 
-	err = c.virtClient.EnsureVolumeRemoved(ctx, c.infraClusterNamespace, vmName, dvName, time.Minute*2)
+	timeout := boundedTimeout(ctx, c.timeouts.hotplug())
+	err = c.virtClient.EnsureVolumeRemoved(ctx, vmNamespace, vmName, dvName, timeout)
 	if err != nil {
-		klog.Errorf("volume %s failed to be removed in time (2m) from VM %s, %v", dvName, vmName, err)
-		return nil, err
+		klog.Errorf("volume %s failed to be removed in time (%v) from VM %s, %v", dvName, timeout, vmName, err)
+		return nil, waitError(err, "volume %s is not removed from VM %s", dvName, vmName)
 	}
 
 	klog.V(3).Infof("Successfully unpublished volume %s from VM %s", dvName, vmName)
@@ -577,9 +800,9 @@ func (c *ControllerService) ControllerUnpublishVolume(ctx context.Context, req *
 // the VM spec or the VMI hot-plug status. Both surfaces must be checked: the
 // VM spec alone can lag the VMI status during a virt-api/virt-handler split,
 // and the VM object itself can be gone while the VMI is still alive.
-func (c *ControllerService) volumeStillAttached(ctx context.Context, vmName, dvName string) (bool, error) {
+func (c *ControllerService) volumeStillAttached(ctx context.Context, vmNamespace, vmName, dvName string) (bool, error) {
 	vmGone := false
-	_, err := c.virtClient.GetWorkloadManagingVirtualMachine(ctx, c.infraClusterNamespace, vmName)
+	_, err := c.virtClient.GetWorkloadManagingVirtualMachine(ctx, vmNamespace, vmName)
 	switch {
 	case err == nil:
 	case errors.IsNotFound(err):
@@ -589,7 +812,7 @@ func (c *ControllerService) volumeStillAttached(ctx context.Context, vmName, dvN
 	}
 
 	if !vmGone {
-		removedFromVM, err := c.virtClient.EnsureVolumeRemovedVM(ctx, c.infraClusterNamespace, vmName, dvName)
+		removedFromVM, err := c.virtClient.EnsureVolumeRemovedVM(ctx, vmNamespace, vmName, dvName)
 		if err != nil {
 			return false, err
 		}
@@ -598,15 +821,18 @@ func (c *ControllerService) volumeStillAttached(ctx context.Context, vmName, dvN
 		}
 	}
 
-	removedFromVMI, err := c.virtClient.EnsureVolumeRemovedVMI(ctx, c.infraClusterNamespace, vmName, dvName)
+	removedFromVMI, err := c.virtClient.EnsureVolumeRemovedVMI(ctx, vmNamespace, vmName, dvName)
 	if err != nil {
 		return false, err
 	}
 	return !removedFromVMI, nil
 }
 
-func (c *ControllerService) removeVolumeFromVm(ctx context.Context, dvName, vmName string) error {
-	vm, err := c.virtClient.GetWorkloadManagingVirtualMachine(ctx, c.infraClusterNamespace, vmName)
+func (c *ControllerService) removeVolumeFromVm(ctx context.Context, dvName, vmNamespace, vmName string) error {
+	if err := c.checkNotMigrating(ctx, vmNamespace, vmName); err != nil {
+		return err
+	}
+	vm, err := c.virtClient.GetWorkloadManagingVirtualMachine(ctx, vmNamespace, vmName)
 	if err != nil && !errors.IsNotFound(err) {
 		return err
 	}
@@ -623,7 +849,7 @@ func (c *ControllerService) removeVolumeFromVm(ctx context.Context, dvName, vmNa
 		}
 		if removePossibleVM {
 			// Detach DataVolume from VM
-			err = c.virtClient.RemoveVolumeFromVM(ctx, c.infraClusterNamespace, vmName, &kubevirtv1.RemoveVolumeOptions{Name: dvName})
+			err = c.virtClient.RemoveVolumeFromVM(ctx, vmNamespace, vmName, &kubevirtv1.RemoveVolumeOptions{Name: dvName})
 			if err != nil {
 				return err
 			}
@@ -639,11 +865,11 @@ func (c *ControllerService) removeVolumeFromVm(ctx context.Context, dvName, vmNa
 	//   2) VM teardown races where the VM object is deleted before the VMI
 	//      finishes terminating; the hot-plug pod is still active and must
 	//      be released to free the infra-side storage attachment.
-	vmi, err := c.virtClient.GetVirtualMachine(ctx, c.infraClusterNamespace, vmName)
+	vmi, err := c.virtClient.GetVirtualMachine(ctx, vmNamespace, vmName)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Both VM and VMI are gone — truly vacuous success.
-			klog.V(3).Infof("VM and VMI %s/%s both gone, considering volume %s detached", c.infraClusterNamespace, vmName, dvName)
+			klog.V(3).Infof("VM and VMI %s/%s both gone, considering volume %s detached", vmNamespace, vmName, dvName)
 			return nil
 		}
 		return err
@@ -656,7 +882,7 @@ func (c *ControllerService) removeVolumeFromVm(ctx context.Context, dvName, vmNa
 	}
 	if removePossibleVMI {
 		// Detach DataVolume from VMI
-		err = c.virtClient.RemoveVolumeFromVMI(ctx, c.infraClusterNamespace, vmName, &kubevirtv1.RemoveVolumeOptions{Name: dvName})
+		err = c.virtClient.RemoveVolumeFromVMI(ctx, vmNamespace, vmName, &kubevirtv1.RemoveVolumeOptions{Name: dvName})
 		if err != nil {
 			return err
 		}
@@ -679,9 +905,12 @@ func (c *ControllerService) ValidateVolumeCapabilities(ctx context.Context, req
 			return nil, status.Error(codes.InvalidArgument, "mount type is undefined")
 		}
 	}
-	dvName := req.GetVolumeId()
+	dvNamespace, dvName, err := c.splitInfraObjectID(req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
 	klog.V(3).Infof("DataVolume name %s", dvName)
-	if _, err := c.virtClient.GetDataVolume(ctx, c.infraClusterNamespace, dvName); errors.IsNotFound(err) {
+	if _, err := c.virtClient.GetDataVolume(ctx, dvNamespace, dvName); errors.IsNotFound(err) {
 		return nil, status.Errorf(codes.NotFound, "volume %s not found", req.GetVolumeId())
 	} else if err != nil {
 		return nil, err
@@ -727,8 +956,8 @@ func (c *ControllerService) validateCreateSnapshotRequest(req *csi.CreateSnapsho
 	return nil
 }
 
-func (c *ControllerService) verifySourceVolumeExists(ctx context.Context, volumeID string) (bool, error) {
-	dv, err := c.virtClient.GetDataVolume(ctx, c.infraClusterNamespace, volumeID)
+func (c *ControllerService) verifySourceVolumeExists(ctx context.Context, namespace, name string) (bool, error) {
+	dv, err := c.virtClient.GetDataVolume(ctx, namespace, name)
 	if errors.IsNotFound(err) {
 		return false, nil
 	}
@@ -740,48 +969,54 @@ func (c *ControllerService) CreateSnapshot(ctx context.Context, req *csi.CreateS
 		return nil, err
 	}
 
+	// Snapshots are taken in the namespace of their source volume.
+	namespace, sourceName, err := c.splitInfraObjectID(req.GetSourceVolumeId())
+	if err != nil {
+		return nil, err
+	}
+
 	var response *csi.CreateSnapshotResponse
-	if existingSnapshot, err := c.virtClient.GetVolumeSnapshot(ctx, c.infraClusterNamespace, req.GetName()); errors.IsNotFound(err) {
-		if exists, err := c.verifySourceVolumeExists(ctx, req.GetSourceVolumeId()); err != nil {
+	if existingSnapshot, err := c.virtClient.GetVolumeSnapshot(ctx, namespace, req.GetName()); errors.IsNotFound(err) {
+		if exists, err := c.verifySourceVolumeExists(ctx, namespace, sourceName); err != nil {
 			return nil, err
 		} else if !exists {
 			return nil, status.Errorf(codes.NotFound, "source volume %s not found", req.GetSourceVolumeId())
 		}
 		// Prepare parameters for the DataVolume
 		snapshotClassName := req.Parameters[client.InfraSnapshotClassNameParameter]
-		volumeSnapshot, err := c.virtClient.CreateVolumeSnapshot(ctx, c.infraClusterNamespace, req.GetName(), req.GetSourceVolumeId(), snapshotClassName)
+		volumeSnapshot, err := c.virtClient.CreateVolumeSnapshot(ctx, namespace, req.GetName(), sourceName, snapshotClassName)
 		if err != nil {
 			return nil, err
 		}
 		// Need to wait for the snapshot to be ready in the infra cluster so we can properly report the size
 		// to the volume snapshot in the tenant cluster. Otherwise the restore size will be 0.
-		if err := c.virtClient.EnsureSnapshotReady(ctx, c.infraClusterNamespace, volumeSnapshot.Name, time.Minute*2); err != nil {
-			return nil, err
+		if err := c.virtClient.EnsureSnapshotReady(ctx, namespace, volumeSnapshot.Name, boundedTimeout(ctx, c.timeouts.snapshot())); err != nil {
+			return nil, waitError(err, "snapshot %s is not ready", volumeSnapshot.Name)
 		}
-		volumeSnapshot, err = c.virtClient.GetVolumeSnapshot(ctx, c.infraClusterNamespace, volumeSnapshot.Name)
+		volumeSnapshot, err = c.virtClient.GetVolumeSnapshot(ctx, namespace, volumeSnapshot.Name)
 		if err != nil {
 			return nil, err
 		}
-		response = createSnapshotResponse(volumeSnapshot)
+		response = c.createSnapshotResponse(volumeSnapshot)
 	} else if err != nil {
 		return nil, err
 	} else {
-		if !snapshotSourceMatchesVolume(existingSnapshot, req.GetSourceVolumeId()) {
+		if !snapshotSourceMatchesVolume(existingSnapshot, sourceName) {
 			return nil, status.Errorf(codes.AlreadyExists, "snapshot with the same name: %s but with different SourceVolumeId already exist", req.GetName())
 		}
-		response = createSnapshotResponse(existingSnapshot)
+		response = c.createSnapshotResponse(existingSnapshot)
 	}
 	return response, nil
 }
 
-func snapshotSourceMatchesVolume(snapshot *snapshotv1.VolumeSnapshot, volumeID string) bool {
-	return snapshot.Spec.Source.PersistentVolumeClaimName != nil && *snapshot.Spec.Source.PersistentVolumeClaimName == volumeID
+func snapshotSourceMatchesVolume(snapshot *snapshotv1.VolumeSnapshot, dvName string) bool {
+	return snapshot.Spec.Source.PersistentVolumeClaimName != nil && *snapshot.Spec.Source.PersistentVolumeClaimName == dvName
 }
 
-func createCsiSnapshot(snapshot *snapshotv1.VolumeSnapshot) *csi.Snapshot {
+func (c *ControllerService) createCsiSnapshot(snapshot *snapshotv1.VolumeSnapshot) *csi.Snapshot {
 	res := &csi.Snapshot{
-		SnapshotId:     snapshot.Name,
-		SourceVolumeId: *snapshot.Spec.Source.PersistentVolumeClaimName,
+		SnapshotId:     c.infraObjectID(snapshot.Namespace, snapshot.Name),
+		SourceVolumeId: c.infraObjectID(snapshot.Namespace, *snapshot.Spec.Source.PersistentVolumeClaimName),
 		CreationTime:   timestamppb.New(snapshot.GetCreationTimestamp().Time),
 		ReadyToUse:     false,
 	}
@@ -796,9 +1031,9 @@ func createCsiSnapshot(snapshot *snapshotv1.VolumeSnapshot) *csi.Snapshot {
 	return res
 }
 
-func createSnapshotResponse(snapshot *snapshotv1.VolumeSnapshot) *csi.CreateSnapshotResponse {
+func (c *ControllerService) createSnapshotResponse(snapshot *snapshotv1.VolumeSnapshot) *csi.CreateSnapshotResponse {
 	return &csi.CreateSnapshotResponse{
-		Snapshot: createCsiSnapshot(snapshot),
+		Snapshot: c.createCsiSnapshot(snapshot),
 	}
 }
 
@@ -809,7 +1044,11 @@ func (c *ControllerService) DeleteSnapshot(ctx context.Context, req *csi.DeleteS
 	if len(req.GetSnapshotId()) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "snapshot id missing in request")
 	}
-	if err := c.virtClient.DeleteVolumeSnapshot(ctx, c.infraClusterNamespace, req.GetSnapshotId()); err != nil {
+	namespace, name, err := c.splitInfraObjectID(req.GetSnapshotId())
+	if err != nil {
+		return nil, err
+	}
+	if err := c.virtClient.DeleteVolumeSnapshot(ctx, namespace, name); err != nil {
 		return nil, err
 	}
 	return &csi.DeleteSnapshotResponse{}, nil
@@ -823,36 +1062,48 @@ func (c *ControllerService) ListSnapshots(ctx context.Context, req *csi.ListSnap
 	var items []snapshotv1.VolumeSnapshot
 
 	if req.GetSnapshotId() != "" {
-		if snapshot, err := c.virtClient.GetVolumeSnapshot(ctx, c.infraClusterNamespace, req.GetSnapshotId()); err != nil && !errors.IsNotFound(err) {
+		namespace, name, err := c.splitInfraObjectID(req.GetSnapshotId())
+		if err != nil {
+			return nil, err
+		}
+		if snapshot, err := c.virtClient.GetVolumeSnapshot(ctx, namespace, name); err != nil && !errors.IsNotFound(err) {
 			return nil, err
 		} else if snapshot != nil {
 			items = append(items, *snapshot)
 		}
-	} else {
-		snapshots, err := c.virtClient.ListVolumeSnapshots(ctx, c.infraClusterNamespace)
+	} else if len(req.GetSourceVolumeId()) > 0 {
+		namespace, sourceName, err := c.splitInfraObjectID(req.GetSourceVolumeId())
 		if err != nil {
 			return nil, err
 		}
-		if len(req.GetSourceVolumeId()) > 0 {
-			// Search for the snapshot that matches the source volume id
-			for _, snapshot := range snapshots.Items {
-				if snapshotSourceMatchesVolume(&snapshot, req.GetSourceVolumeId()) {
-					items = append(items, snapshot)
-				}
+		snapshots, err := c.virtClient.ListVolumeSnapshots(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		// Search for the snapshot that matches the source volume id
+		for _, snapshot := range snapshots.Items {
+			if snapshotSourceMatchesVolume(&snapshot, sourceName) {
+				items = append(items, snapshot)
 			}
-		} else {
-			items = snapshots.Items
+		}
+	} else {
+		for _, namespace := range c.infraNamespaces() {
+			snapshots, err := c.virtClient.ListVolumeSnapshots(ctx, namespace)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, snapshots.Items...)
 		}
 	}
 
-	if snapshotRes, err := createSnapshotResponseFromItems(req, items); err != nil {
+	if snapshotRes, err := c.createSnapshotResponseFromItems(req, items); err != nil {
 		return nil, err
 	} else {
 		return snapshotRes, nil
 	}
 }
 
-func createSnapshotResponseFromItems(req *csi.ListSnapshotsRequest, items []snapshotv1.VolumeSnapshot) (*csi.ListSnapshotsResponse, error) {
+func (c *ControllerService) createSnapshotResponseFromItems(req *csi.ListSnapshotsRequest, items []snapshotv1.VolumeSnapshot) (*csi.ListSnapshotsResponse, error) {
 	snapshotRes := &csi.ListSnapshotsResponse{}
 	if len(items) > 0 {
 		snapshotRes.Entries = []*csi.ListSnapshotsResponse_Entry{}
@@ -878,7 +1129,7 @@ func createSnapshotResponseFromItems(req *csi.ListSnapshotsRequest, items []snap
 
 		for _, val := range items[start:end] {
 			snapshotRes.Entries = append(snapshotRes.Entries, &csi.ListSnapshotsResponse_Entry{
-				Snapshot: createCsiSnapshot(&val),
+				Snapshot: c.createCsiSnapshot(&val),
 			})
 		}
 		if end < snapshotLength-1 {
@@ -894,14 +1145,17 @@ func (c *ControllerService) ControllerExpandVolume(ctx context.Context, req *csi
 	if len(volumeID) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "Volume ID not provided")
 	}
+	namespace, claimName, err := c.splitInfraObjectID(volumeID)
+	if err != nil {
+		return nil, err
+	}
 	capRange := req.GetCapacityRange()
 	if capRange == nil {
 		return nil, status.Error(codes.InvalidArgument, "Capacity range not provided")
 	}
 	newSize := capRange.GetRequiredBytes()
-	isBlock := req.GetVolumeCapability().GetBlock() != nil
 
-	err := c.virtClient.ExpandPersistentVolumeClaim(ctx, c.infraClusterNamespace, volumeID, newSize)
+	err = c.virtClient.ExpandPersistentVolumeClaim(ctx, namespace, claimName, newSize)
 	if err != nil {
 		if !errors.IsNotFound(err) {
 			return nil, status.Errorf(codes.Internal, "Failed to expand PVC %s: %v", volumeID, err)
@@ -909,18 +1163,19 @@ func (c *ControllerService) ControllerExpandVolume(ctx context.Context, req *csi
 		return nil, status.Errorf(codes.NotFound, "volume %s not found", volumeID)
 	}
 
-	err = c.virtClient.EnsureControllerResize(ctx, c.infraClusterNamespace, volumeID, time.Minute*2)
+	timeout := boundedTimeout(ctx, c.timeouts.expand())
+	err = c.virtClient.EnsureControllerResize(ctx, namespace, claimName, timeout)
 	if err != nil {
-		klog.Errorf("controller resize for volume %s failed to be completed in time (2m) %v", volumeID, err)
-		return nil, err
+		klog.Errorf("controller resize for volume %s failed to be completed in time (%v) %v", volumeID, timeout, err)
+		return nil, waitError(err, "resize of volume %s is not completed", volumeID)
 	}
 
 	klog.V(3).Infof("Successfully resized backing volume %s", volumeID)
 
 	return &csi.ControllerExpandVolumeResponse{
 		CapacityBytes: newSize,
-		// Expansion on node only required for filesystem volumes
-		NodeExpansionRequired: !isBlock,
+		// The node makes the guest notice the bigger disk, and grows the filesystem of filesystem volumes.
+		NodeExpansionRequired: true,
 	}, nil
 }
 
@@ -951,15 +1206,15 @@ func (c *ControllerService) ControllerGetVolume(_ context.Context, _ *csi.Contro
 // used by any VirtualMachineInstance other than the current one.
 //
 // NOTE: This function uses vmi.Status.VolumeStatus as the source of truth for
-// what is currently attached. It directly compares the volume name in the status
-// with the target PVC name.
+// what is currently attached. The client looks the VMIs up by the volume names
+// in their status.
 func (c *ControllerService) IsVolumeAttachedToOtherVMI(
 	ctx context.Context,
 	dvName string,
 	infraNamespace string,
 	currentVMIName string,
 ) (bool, error) {
-	vmis, err := c.virtClient.ListVirtualMachines(ctx, infraNamespace)
+	vmis, err := c.virtClient.ListVirtualMachinesWithVolume(ctx, infraNamespace, dvName)
 	if err != nil {
 		return false, fmt.Errorf("failed to list Virtual Machine Instances in namespace %s: %w", infraNamespace, err)
 	}
@@ -970,19 +1225,11 @@ func (c *ControllerService) IsVolumeAttachedToOtherVMI(
 			continue
 		}
 
-		// The source of truth is the VMI's status. We iterate through the volumes
-		// that are reported as active in the status.
-		for _, volumeStatus := range vmi.Status.VolumeStatus {
-			// If the name in the status matches our PVC name, it means the volume
-			// is actively attached to this other VMI.
-			if volumeStatus.Name == dvName {
-				klog.Infof(
-					"CONFLICT: PVC %s/%s is in use by VMI %s/%s",
-					infraNamespace, dvName, vmi.Namespace, vmi.Name,
-				)
-				return true, nil
-			}
-		}
+		klog.Infof(
+			"CONFLICT: PVC %s/%s is in use by VMI %s/%s",
+			infraNamespace, dvName, vmi.Namespace, vmi.Name,
+		)
+		return true, nil
 	}
 
 	return false, nil
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -16,6 +17,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/utils/ptr"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
@@ -141,6 +143,97 @@ var _ = Describe("CreateVolume", func() {
 		Expect(response.GetVolume().GetVolumeContext()[busParameter]).To(Equal(string(busTypeLocal)))
 	})
 
+	It("should propagate the encrypted parameter to the volume context", func() {
+		controller := ControllerService{
+			virtClient:              &ControllerClientMock{},
+			infraClusterNamespace:   testInfraNamespace,
+			infraClusterLabels:      testInfraLabels,
+			storageClassEnforcement: storageClassEnforcement,
+		}
+
+		request := getCreateVolumeRequest(getVolumeCapability(corev1.PersistentVolumeFilesystem, csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER))
+		request.Parameters[encryptedParameter] = "true"
+		response, err := controller.CreateVolume(context.TODO(), request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.GetVolume().GetVolumeContext()[encryptedParameter]).To(Equal("true"))
+
+		request.Parameters[encryptedParameter] = "maybe"
+		_, err = controller.CreateVolume(context.TODO(), request)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should validate mkfsOptions and propagate them to the volume context", func() {
+		controller := ControllerService{
+			virtClient:              &ControllerClientMock{},
+			infraClusterNamespace:   testInfraNamespace,
+			infraClusterLabels:      testInfraLabels,
+			storageClassEnforcement: storageClassEnforcement,
+		}
+
+		capability := getVolumeCapability(corev1.PersistentVolumeFilesystem, csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER)
+		capability.AccessType = &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "xfs"}}
+		request := getCreateVolumeRequest(capability)
+		request.Parameters[mkfsOptionsParameter] = "-m reflink=1 -K"
+		response, err := controller.CreateVolume(context.TODO(), request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.GetVolume().GetVolumeContext()[mkfsOptionsParameter]).To(Equal("-m reflink=1 -K"))
+
+		request.Parameters[mkfsOptionsParameter] = "-E lazy_itable_init=0"
+		_, err = controller.CreateVolume(context.TODO(), request)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should create volumes with discard without preallocation", func() {
+		client := &ControllerClientMock{}
+		controller := ControllerService{
+			virtClient:              client,
+			infraClusterNamespace:   testInfraNamespace,
+			infraClusterLabels:      testInfraLabels,
+			storageClassEnforcement: storageClassEnforcement,
+		}
+
+		request := getCreateVolumeRequest(getVolumeCapability(corev1.PersistentVolumeFilesystem, csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER))
+		request.Parameters[discardParameter] = discardFstrim
+		response, err := controller.CreateVolume(context.TODO(), request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.GetVolume().GetVolumeContext()[discardParameter]).To(Equal(discardFstrim))
+		dv := client.datavolumes[getKey(testInfraNamespace, testVolumeName)]
+		Expect(dv.Spec.Preallocation).To(HaveValue(BeFalse()))
+	})
+
+	It("should reject an unknown discard mode", func() {
+		controller := ControllerService{
+			virtClient:              &ControllerClientMock{},
+			infraClusterNamespace:   testInfraNamespace,
+			infraClusterLabels:      testInfraLabels,
+			storageClassEnforcement: storageClassEnforcement,
+		}
+
+		request := getCreateVolumeRequest(getVolumeCapability(corev1.PersistentVolumeFilesystem, csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER))
+		request.Parameters[discardParameter] = "always"
+		_, err := controller.CreateVolume(context.TODO(), request)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should validate the fsckPolicy and propagate it to the volume context", func() {
+		controller := ControllerService{
+			virtClient:              &ControllerClientMock{},
+			infraClusterNamespace:   testInfraNamespace,
+			infraClusterLabels:      testInfraLabels,
+			storageClassEnforcement: storageClassEnforcement,
+		}
+
+		request := getCreateVolumeRequest(getVolumeCapability(corev1.PersistentVolumeFilesystem, csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER))
+		request.Parameters[fsckPolicyParameter] = fsckPolicyRepair
+		response, err := controller.CreateVolume(context.TODO(), request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.GetVolume().GetVolumeContext()[fsckPolicyParameter]).To(Equal(fsckPolicyRepair))
+
+		request.Parameters[fsckPolicyParameter] = "sometimes"
+		_, err = controller.CreateVolume(context.TODO(), request)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
 	It("should not allow storage class not in the allow list", func() {
 		cli := &ControllerClientMock{}
 		storageClassEnforcement = util.StorageClassEnforcement{
@@ -188,8 +281,9 @@ var _ = Describe("CreateVolume", func() {
 			},
 		}
 
-		_, err := controller.CreateVolume(context.TODO(), request)
+		response, err := controller.CreateVolume(context.TODO(), request)
 		Expect(err).ToNot(HaveOccurred())
+		Expect(response.GetVolume().GetVolumeContext()[contentSourceParameter]).To(Equal(contentSourceSnapshot))
 	})
 
 	It("should fail to create a volume with a snapshot datasource, if snapshot not found", func() {
@@ -240,8 +334,9 @@ var _ = Describe("CreateVolume", func() {
 			},
 		}
 
-		_, err := controller.CreateVolume(context.TODO(), request)
+		response, err := controller.CreateVolume(context.TODO(), request)
 		Expect(err).ToNot(HaveOccurred())
+		Expect(response.GetVolume().GetVolumeContext()[contentSourceParameter]).To(Equal(contentSourceVolume))
 	})
 
 	It("should fail to create a volume with a volume datasource, if volume not found", func() {
@@ -335,6 +430,36 @@ var _ = Describe("PublishUnPublish", func() {
 		Expect(err).ToNot(HaveOccurred())
 	})
 
+	Context("to a stopped VM", func() {
+		var stopped *stoppedVMClient
+
+		BeforeEach(func() {
+			stopped = &stoppedVMClient{ControllerClientMock: client}
+			controller.virtClient = stopped
+			controller.timeouts = ControllerTimeouts{Hotplug: time.Hour}
+			client.datavolumes = map[string]*cdiv1.DataVolume{
+				getKey(testInfraNamespace, testVolumeName): {
+					ObjectMeta: metav1.ObjectMeta{Name: testVolumeName, Namespace: testInfraNamespace, Labels: testInfraLabels},
+				},
+			}
+		})
+
+		It("should succeed once the volume is in the VM spec", func() {
+			stopped.addsVolumes = true
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(client.addVolumeToVMOccured).To(BeTrue())
+		})
+
+		It("should return DeadlineExceeded when the volume doesn't show up in the VM spec", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			_, err := controller.ControllerPublishVolume(ctx, getPublishVolumeRequest())
+			Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+			Expect(client.addVolumeToVMOccured).To(BeTrue())
+		})
+	})
+
 	It("should successfully unpublish", func() {
 		client.vmVolumes = []kubevirtv1.Volume{
 			{
@@ -403,6 +528,321 @@ var _ = Describe("PublishUnPublish", func() {
 		Expect(capturingClient.hotunplugForVMIOccured).To(BeTrue(), "RemoveVolumeFromVMI must be invoked when VM is gone but VMI still has the hot-plug")
 	})
 
+	Context("VM ownership", func() {
+		BeforeEach(func() {
+			client.datavolumes = map[string]*cdiv1.DataVolume{
+				getKey(testInfraNamespace, testVolumeName): {
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      testVolumeName,
+						Namespace: testInfraNamespace,
+					},
+				},
+			}
+			controller.vmOwnership = VMOwnership{
+				Enforce:         true,
+				AnnotationKey:   "example.com/tenant",
+				AnnotationValue: "cluster-a",
+			}
+		})
+
+		It("should attach to a VM with the infra cluster labels", func() {
+			client.vmLabels = testInfraLabels
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should attach to a VM with the ownership annotation", func() {
+			client.vmAnnotations = map[string]string{"example.com/tenant": "cluster-a"}
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should not attach to a VM of another tenant", func() {
+			client.FailAddVolumeToVM = true
+			client.vmAnnotations = map[string]string{"example.com/tenant": "cluster-b"}
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+		})
+
+		It("should not attach to a standalone VMI of another tenant", func() {
+			client.ShouldReturnVMNotFound = true
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+			Expect(client.addVolumeToVMIOccured).To(BeFalse())
+		})
+
+		It("should attach to any VM when there are neither infra cluster labels nor an annotation", func() {
+			controller.infraClusterLabels = nil
+			controller.vmOwnership = VMOwnership{Enforce: true}
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should only attach to annotated VMs when there are no infra cluster labels", func() {
+			controller.infraClusterLabels = nil
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+			client.vmAnnotations = map[string]string{"example.com/tenant": "cluster-a"}
+			_, err = controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should attach to any VM when not enforced", func() {
+			controller.vmOwnership.Enforce = false
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("Standalone VMIs", func() {
+		BeforeEach(func() {
+			client.datavolumes = map[string]*cdiv1.DataVolume{
+				getKey(testInfraNamespace, testVolumeName): {
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      testVolumeName,
+						Namespace: testInfraNamespace,
+					},
+				},
+			}
+			client.ShouldReturnVMNotFound = true
+		})
+
+		It("should hot-plug into the VMI when there is no VM", func() {
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(client.addVolumeToVMIOccured).To(BeTrue())
+		})
+
+		It("should skip the hot-plug when the VMI has the volume already", func() {
+			client.vmiVolumes = []kubevirtv1.Volume{{
+				Name: testVolumeName,
+				VolumeSource: kubevirtv1.VolumeSource{
+					DataVolume: &kubevirtv1.DataVolumeSource{
+						Name:         testVolumeName,
+						Hotpluggable: true,
+					},
+				},
+			}}
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(client.addVolumeToVMIOccured).To(BeFalse())
+		})
+	})
+
+	Context("Attach limits", func() {
+		BeforeEach(func() {
+			client.datavolumes = map[string]*cdiv1.DataVolume{
+				getKey(testInfraNamespace, testVolumeName): {
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      testVolumeName,
+						Namespace: testInfraNamespace,
+					},
+				},
+			}
+			client.vmVolumes = []kubevirtv1.Volume{{
+				Name: "other-volume",
+				VolumeSource: kubevirtv1.VolumeSource{
+					DataVolume: &kubevirtv1.DataVolumeSource{
+						Name:         "other-volume",
+						Hotpluggable: true,
+					},
+				},
+			}}
+			client.vmDisks = []kubevirtv1.Disk{{
+				Name: "other-volume",
+				DiskDevice: kubevirtv1.DiskDevice{
+					Disk: &kubevirtv1.DiskTarget{Bus: getBusType()},
+				},
+			}}
+		})
+
+		It("should not publish a volume when the VM has reached the attach limit", func() {
+			controller.maxVolumesPerNode = 1
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+		})
+
+		It("should publish a volume when the VM is below the attach limit", func() {
+			controller.maxVolumesPerNode = 2
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should only count the volumes on the same bus", func() {
+			controller.maxVolumesPerNode = 1
+			client.vmDisks[0].Disk.Bus = kubevirtv1.DiskBusSATA
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should count the volumes the VM has pending add requests for", func() {
+			controller.maxVolumesPerNode = 2
+			client.vmVolumeRequests = []kubevirtv1.VirtualMachineVolumeRequest{{
+				AddVolumeOptions: &kubevirtv1.AddVolumeOptions{
+					Name: "pending-volume",
+					Disk: &kubevirtv1.Disk{
+						DiskDevice: kubevirtv1.DiskDevice{Disk: &kubevirtv1.DiskTarget{Bus: getBusType()}},
+					},
+				},
+			}}
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+			Expect(client.addVolumeToVMOccured).To(BeFalse())
+		})
+
+		It("should not request a volume again while its add request is pending", func() {
+			controller.maxVolumesPerNode = 1
+			client.vmVolumeRequests = []kubevirtv1.VirtualMachineVolumeRequest{{
+				AddVolumeOptions: &kubevirtv1.AddVolumeOptions{
+					Name: testVolumeName,
+					Disk: &kubevirtv1.Disk{
+						DiskDevice: kubevirtv1.DiskDevice{Disk: &kubevirtv1.DiskTarget{Bus: getBusType()}},
+					},
+				},
+			}}
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(client.addVolumeToVMOccured).To(BeFalse())
+		})
+
+		DescribeTable("should default the limit by bus", func(configured int64, bus kubevirtv1.DiskBus, expected int64) {
+			Expect(maxHotplugVolumes(configured, bus)).To(Equal(expected))
+		},
+			Entry("scsi", int64(0), kubevirtv1.DiskBusSCSI, int64(64)),
+			Entry("virtio", int64(0), kubevirtv1.DiskBusVirtio, int64(14)),
+			Entry("unknown bus", int64(0), kubevirtv1.DiskBusSATA, int64(64)),
+			Entry("configured", int64(8), kubevirtv1.DiskBusVirtio, int64(8)),
+		)
+	})
+
+	Context("Node namespaces", func() {
+		const tenantNamespace = "tenant-vms"
+
+		BeforeEach(func() {
+			client.datavolumes = map[string]*cdiv1.DataVolume{
+				getKey(tenantNamespace, testVolumeName): {
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      testVolumeName,
+						Namespace: tenantNamespace,
+					},
+				},
+			}
+		})
+
+		It("should attach to a VM in an allowed namespace", func() {
+			controller.allowedNamespaces = []string{tenantNamespace}
+			req := getPublishVolumeRequest()
+			req.VolumeId = getKey(tenantNamespace, testVolumeName)
+			req.NodeId = getKey(tenantNamespace, testVMName)
+			_, err := controller.ControllerPublishVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should create a volume in an allowed namespace and attach it to a VM of that namespace", func() {
+			controller.allowedNamespaces = []string{tenantNamespace}
+			client.datavolumes = nil
+			createReq := getCreateVolumeRequest(getVolumeCapability(corev1.PersistentVolumeFilesystem, csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER))
+			createReq.Parameters[infraNamespaceParameter] = tenantNamespace
+			createResp, err := controller.CreateVolume(context.TODO(), createReq)
+			Expect(err).ToNot(HaveOccurred())
+			volumeID := createResp.GetVolume().GetVolumeId()
+			Expect(volumeID).To(Equal(getKey(tenantNamespace, testVolumeName)))
+			Expect(client.datavolumes).To(HaveKey(getKey(tenantNamespace, testVolumeName)))
+
+			publishReq := getPublishVolumeRequest()
+			publishReq.VolumeId = volumeID
+			publishReq.NodeId = getKey(tenantNamespace, testVMName)
+			_, err = controller.ControllerPublishVolume(context.TODO(), publishReq)
+			Expect(err).ToNot(HaveOccurred())
+
+			snapshotResp, err := controller.CreateSnapshot(context.TODO(), &csi.CreateSnapshotRequest{Name: "snapshot", SourceVolumeId: volumeID})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshotResp.GetSnapshot().GetSnapshotId()).To(Equal(getKey(tenantNamespace, "snapshot")))
+			Expect(snapshotResp.GetSnapshot().GetSourceVolumeId()).To(Equal(volumeID))
+			Expect(client.snapshots).To(HaveKey(getKey(tenantNamespace, "snapshot")))
+			listResp, err := controller.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(listResp.GetEntries()).To(HaveLen(1))
+
+			_, err = controller.ControllerExpandVolume(context.TODO(), &csi.ControllerExpandVolumeRequest{
+				VolumeId:      volumeID,
+				CapacityRange: &csi.CapacityRange{RequiredBytes: 2 * testVolumeStorageSize},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = controller.DeleteVolume(context.TODO(), &csi.DeleteVolumeRequest{VolumeId: volumeID})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should not create volumes in a namespace that is not allowed", func() {
+			createReq := getCreateVolumeRequest(getVolumeCapability(corev1.PersistentVolumeFilesystem, csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER))
+			createReq.Parameters[infraNamespaceParameter] = tenantNamespace
+			_, err := controller.CreateVolume(context.TODO(), createReq)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			_, err = controller.DeleteVolume(context.TODO(), &csi.DeleteVolumeRequest{VolumeId: getKey(tenantNamespace, testVolumeName)})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		It("should reject a node in a namespace that is not allowed", func() {
+			req := getPublishVolumeRequest()
+			req.NodeId = getKey(tenantNamespace, testVMName)
+			_, err := controller.ControllerPublishVolume(context.TODO(), req)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+			_, err = controller.ControllerUnpublishVolume(context.TODO(), &csi.ControllerUnpublishVolumeRequest{
+				VolumeId: testVolumeName,
+				NodeId:   req.NodeId,
+			})
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		It("should require the volume to be in the namespace of the VM", func() {
+			controller.allowedNamespaces = []string{tenantNamespace, "other-vms"}
+			req := getPublishVolumeRequest()
+			req.VolumeId = getKey(tenantNamespace, testVolumeName)
+			req.NodeId = getKey("other-vms", testVMName)
+			_, err := controller.ControllerPublishVolume(context.TODO(), req)
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+			Expect(err.Error()).To(ContainSubstring("in namespace " + tenantNamespace))
+		})
+	})
+
+	Context("Live migration", func() {
+		BeforeEach(func() {
+			client.datavolumes = map[string]*cdiv1.DataVolume{
+				getKey(testInfraNamespace, testVolumeName): {
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      testVolumeName,
+						Namespace: testInfraNamespace,
+					},
+				},
+			}
+			client.activeMigration = &kubevirtv1.VirtualMachineInstanceMigration{
+				ObjectMeta: metav1.ObjectMeta{Name: "migration", Namespace: testInfraNamespace},
+			}
+		})
+
+		It("should not hot-plug while the VM is migrating", func() {
+			client.FailAddVolumeToVM = true
+			_, err := controller.ControllerPublishVolume(context.TODO(), getPublishVolumeRequest())
+			Expect(status.Code(err)).To(Equal(codes.Unavailable))
+		})
+
+		It("should not hot-unplug while the VM is migrating", func() {
+			client.FailRemoveVolumeFromVM = true
+			client.vmVolumes = []kubevirtv1.Volume{{
+				Name: testVolumeName,
+				VolumeSource: kubevirtv1.VolumeSource{
+					DataVolume: &kubevirtv1.DataVolumeSource{
+						Name:         testVolumeName,
+						Hotpluggable: true,
+					},
+				},
+			}}
+			_, err := controller.ControllerUnpublishVolume(context.TODO(), getUnpublishVolumeRequest())
+			Expect(status.Code(err)).To(Equal(codes.Unavailable))
+		})
+	})
+
 	Context("Multi-attach", func() {
 
 		BeforeEach(func() {
@@ -825,6 +1265,23 @@ var _ = Describe("Expand", func() {
 		Expect(client.ExpansionOccured).To(BeTrue())
 		Expect(client.ExpansionVerified).To(BeTrue())
 	})
+
+	It("should require node expansion of block volumes", func() {
+		res, err := controller.ControllerExpandVolume(context.TODO(), &csi.ControllerExpandVolumeRequest{
+			VolumeId: testVolumeName,
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Block{
+					Block: &csi.VolumeCapability_BlockVolume{},
+				},
+			},
+			CapacityRange: &csi.CapacityRange{
+				RequiredBytes: 1024 * 1024 * 1024,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		// The guest only notices the bigger disk once the node rescans it.
+		Expect(res.GetNodeExpansionRequired()).To(BeTrue())
+	})
 })
 
 //
@@ -947,6 +1404,14 @@ type ControllerClientMock struct {
 	ExpansionVerified            bool
 	virtualMachineStatus         kubevirtv1.VirtualMachineInstanceStatus
 	vmVolumes                    []kubevirtv1.Volume
+	vmDisks                      []kubevirtv1.Disk
+	vmVolumeRequests             []kubevirtv1.VirtualMachineVolumeRequest
+	activeMigration              *kubevirtv1.VirtualMachineInstanceMigration
+	vmiVolumes                   []kubevirtv1.Volume
+	vmLabels                     map[string]string
+	vmAnnotations                map[string]string
+	addVolumeToVMOccured         bool
+	addVolumeToVMIOccured        bool
 	snapshots                    map[string]*snapshotv1.VolumeSnapshot
 	datavolumes                  map[string]*cdiv1.DataVolume
 	expectedVMName               string
@@ -955,6 +1420,9 @@ type ControllerClientMock struct {
 func (c *ControllerClientMock) Ping(ctx context.Context) error {
 	return errors.New("Not implemented")
 }
+func (c *ControllerClientMock) StartInformers(ctx context.Context, namespace string) error {
+	return nil
+}
 func (c *ControllerClientMock) GetNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
 	return nil, errors.New("Not implemented")
 }
@@ -997,6 +1465,22 @@ func (c *ControllerClientMock) ListVirtualMachines(_ context.Context, namespace
 	}, nil
 }
 
+func (c *ControllerClientMock) ListVirtualMachinesWithVolume(ctx context.Context, namespace, volumeName string) ([]kubevirtv1.VirtualMachineInstance, error) {
+	vmis, err := c.ListVirtualMachines(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var res []kubevirtv1.VirtualMachineInstance
+	for _, vmi := range vmis {
+		for _, volumeStatus := range vmi.Status.VolumeStatus {
+			if volumeStatus.Name == volumeName {
+				res = append(res, vmi)
+			}
+		}
+	}
+	return res, nil
+}
+
 func (c *ControllerClientMock) GetVirtualMachine(_ context.Context, namespace, name string) (*kubevirtv1.VirtualMachineInstance, error) {
 	if c.FailListVirtualMachines {
 		return nil, errors.New("ListVirtualMachines failed")
@@ -1004,10 +1488,14 @@ func (c *ControllerClientMock) GetVirtualMachine(_ context.Context, namespace, n
 
 	return &kubevirtv1.VirtualMachineInstance{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      c.vmLabels,
+			Annotations: c.vmAnnotations,
+		},
+		Spec: kubevirtv1.VirtualMachineInstanceSpec{
+			Volumes: c.vmiVolumes,
 		},
-		Spec:   kubevirtv1.VirtualMachineInstanceSpec{},
 		Status: c.virtualMachineStatus,
 	}, nil
 }
@@ -1021,19 +1509,33 @@ func (c *ControllerClientMock) GetWorkloadManagingVirtualMachine(_ context.Conte
 
 	return &kubevirtv1.VirtualMachine{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      c.vmLabels,
+			Annotations: c.vmAnnotations,
 		},
 		Spec: kubevirtv1.VirtualMachineSpec{
 			Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{
 				Spec: kubevirtv1.VirtualMachineInstanceSpec{
+					Domain: kubevirtv1.DomainSpec{
+						Devices: kubevirtv1.Devices{
+							Disks: c.vmDisks,
+						},
+					},
 					Volumes: volumes,
 				},
 			},
 		},
+		Status: kubevirtv1.VirtualMachineStatus{
+			VolumeRequests: c.vmVolumeRequests,
+		},
 	}, nil
 }
 
+func (c *ControllerClientMock) GetActiveMigration(_ context.Context, namespace, vmiName string) (*kubevirtv1.VirtualMachineInstanceMigration, error) {
+	return c.activeMigration, nil
+}
+
 func (c *ControllerClientMock) DeleteDataVolume(_ context.Context, namespace string, name string) error {
 	if c.FailDeleteDataVolume {
 		return errors.New("DeleteDataVolume failed")
@@ -1113,8 +1615,19 @@ func (c *ControllerClientMock) AddVolumeToVM(_ context.Context, namespace string
 	Expect(getBusType()).To(Equal(addVolumeOptions.Disk.Disk.Bus))
 	Expect(testDataVolumeUID).To(Equal(addVolumeOptions.Disk.Serial))
 
+	c.addVolumeToVMOccured = true
 	return nil
 }
+func (c *ControllerClientMock) AddVolumeToVMI(_ context.Context, namespace string, vmiName string, addVolumeOptions *kubevirtv1.AddVolumeOptions) error {
+	if c.FailAddVolumeToVM {
+		return errors.New("AddVolumeToVMI failed")
+	}
+	Expect(testVMName).To(Equal(vmiName))
+	Expect(testVolumeName).To(Equal(addVolumeOptions.Name))
+	c.addVolumeToVMIOccured = true
+	return nil
+}
+
 func (c *ControllerClientMock) RemoveVolumeFromVM(_ context.Context, namespace string, vmName string, removeVolumeOptions *kubevirtv1.RemoveVolumeOptions) error {
 	if c.FailRemoveVolumeFromVM {
 		return errors.New("RemoveVolumeFromVM failed")
@@ -1217,8 +1730,10 @@ func (c *ControllerClientMock) ListVolumeSnapshots(ctx context.Context, namespac
 		c.snapshots = make(map[string]*snapshotv1.VolumeSnapshot)
 	}
 	res := &snapshotv1.VolumeSnapshotList{}
-	for _, v := range c.snapshots {
-		res.Items = append(res.Items, *v)
+	for k, v := range c.snapshots {
+		if strings.HasPrefix(k, namespace+"/") {
+			res.Items = append(res.Items, *v)
+		}
 	}
 	return res, nil
 }
@@ -1286,6 +1801,101 @@ var _ = Describe("Fast-path publish / unpublish", func() {
 	})
 })
 
+var _ = Describe("Timeouts", func() {
+	It("should cap the wait by the request deadline and return DeadlineExceeded", func() {
+		cli := &resizeTimeoutClient{ControllerClientMock: &ControllerClientMock{}}
+		ctrl := &ControllerService{
+			virtClient:            cli,
+			infraClusterNamespace: testInfraNamespace,
+			timeouts:              ControllerTimeouts{Expand: time.Hour},
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		_, err := ctrl.ControllerExpandVolume(ctx, &csi.ControllerExpandVolumeRequest{
+			VolumeId:      testVolumeName,
+			CapacityRange: &csi.CapacityRange{RequiredBytes: testVolumeStorageSize},
+		})
+		Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+		Expect(cli.timeout).To(BeNumerically("<=", time.Minute))
+	})
+
+	It("should return DeadlineExceeded when the hotplug retries are exhausted", func() {
+		cli := &ControllerClientMock{
+			FailRemoveVolumeFromVM: true,
+			vmVolumes: []kubevirtv1.Volume{{
+				Name: testVolumeName,
+				VolumeSource: kubevirtv1.VolumeSource{
+					DataVolume: &kubevirtv1.DataVolumeSource{
+						Name:         testVolumeName,
+						Hotpluggable: true,
+					},
+				},
+			}},
+		}
+		ctrl := &ControllerService{
+			virtClient:            cli,
+			infraClusterNamespace: testInfraNamespace,
+			timeouts:              ControllerTimeouts{HotplugRetrySteps: 2, HotplugRetryInterval: time.Millisecond},
+		}
+
+		_, err := ctrl.ControllerUnpublishVolume(context.TODO(), getUnpublishVolumeRequest())
+		Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+	})
+})
+
+// stoppedVMClient behaves like the client for a VM that isn't running: it has no VMI, so the volume is available
+// once KubeVirt added it to the VM spec, which it only does when addsVolumes is set.
+type stoppedVMClient struct {
+	*ControllerClientMock
+	addsVolumes bool
+}
+
+func (c *stoppedVMClient) GetVirtualMachine(_ context.Context, namespace, name string) (*kubevirtv1.VirtualMachineInstance, error) {
+	return nil, k8serrors.NewNotFound(kubevirtv1.Resource("virtualmachineinstances"), name)
+}
+
+func (c *stoppedVMClient) AddVolumeToVM(ctx context.Context, namespace, vmName string, addVolumeOptions *kubevirtv1.AddVolumeOptions) error {
+	if err := c.ControllerClientMock.AddVolumeToVM(ctx, namespace, vmName, addVolumeOptions); err != nil {
+		return err
+	}
+	if c.addsVolumes {
+		c.vmVolumes = append(c.vmVolumes, kubevirtv1.Volume{
+			Name:         addVolumeOptions.Name,
+			VolumeSource: kubevirtv1.VolumeSource{DataVolume: addVolumeOptions.VolumeSource.DataVolume},
+		})
+	}
+	return nil
+}
+
+func (c *stoppedVMClient) EnsureVolumeAvailable(ctx context.Context, namespace, vmName, volumeName string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return wait.PollUntilContextCancel(ctx, 10*time.Millisecond, true, func(ctx context.Context) (bool, error) {
+		vm, err := c.GetWorkloadManagingVirtualMachine(ctx, namespace, vmName)
+		if err != nil {
+			return false, err
+		}
+		for _, volume := range vm.Spec.Template.Spec.Volumes {
+			if volume.Name == volumeName {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// records the timeout passed to EnsureControllerResize and times out
+type resizeTimeoutClient struct {
+	*ControllerClientMock
+	timeout time.Duration
+}
+
+func (c *resizeTimeoutClient) EnsureControllerResize(_ context.Context, namespace, claimName string, timeout time.Duration) error {
+	c.timeout = timeout
+	return context.DeadlineExceeded
+}
+
 // returns "already attached", records calls
 type attachSkipClient struct {
 	*ControllerClientMock
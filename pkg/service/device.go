@@ -0,0 +1,537 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+	klog "k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	sysDir      = "/sys"
+	sysBlockDir = "/sys/block"
+	devDir      = "/dev"
+)
+
+// DeviceRescanner makes the guest kernel look for hotplugged disks it hasn't noticed yet.
+type DeviceRescanner interface {
+	Rescan(bus string) error
+}
+
+var NewDeviceRescanner = func() DeviceRescanner {
+	return &sysfsDeviceRescanner{sysDir: sysDir}
+}
+
+// sysfsDeviceRescanner rescans the SCSI hosts for disks on the scsi bus, and the PCI bus for virtio disks, which are
+// PCI devices of their own.
+type sysfsDeviceRescanner struct {
+	sysDir string
+}
+
+func (r *sysfsDeviceRescanner) Rescan(bus string) error {
+	if bus != "scsi" {
+		return os.WriteFile(filepath.Join(r.sysDir, "bus", "pci", "rescan"), []byte("1"), 0200)
+	}
+	hosts, err := filepath.Glob(filepath.Join(r.sysDir, "class", "scsi_host", "host*", "scan"))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, scan := range hosts {
+		// Scan all channels, targets and LUNs of the host.
+		if err := os.WriteFile(scan, []byte("- - -"), 0200); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeviceReleaser makes sure the node is done with a device before the controller unplugs it.
+type DeviceReleaser interface {
+	// Holders returns the devices stacked on the device or its partitions, like dm-crypt mappings.
+	Holders(devicePath string) ([]string, error)
+	// Flush writes the buffered data of the device to the disk and drops the buffers.
+	Flush(devicePath string) error
+}
+
+var NewDeviceReleaser = func() DeviceReleaser {
+	return &sysfsDeviceReleaser{sysBlockDir: sysBlockDir, exec: utilexec.New()}
+}
+
+type sysfsDeviceReleaser struct {
+	sysBlockDir string
+	exec        utilexec.Interface
+}
+
+func (r *sysfsDeviceReleaser) Holders(devicePath string) ([]string, error) {
+	name := filepath.Base(devicePath)
+	holderDirs, err := filepath.Glob(filepath.Join(r.sysBlockDir, name, name+"*", "holders"))
+	if err != nil {
+		return nil, err
+	}
+	var holders []string
+	for _, dir := range append([]string{filepath.Join(r.sysBlockDir, name, "holders")}, holderDirs...) {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			holders = append(holders, entry.Name())
+		}
+	}
+	return holders, nil
+}
+
+func (r *sysfsDeviceReleaser) Flush(devicePath string) error {
+	out, err := r.exec.Command("blockdev", "--flushbufs", devicePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("blockdev --flushbufs failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// DeviceSizer makes the guest kernel notice that a disk was expanded in the infra cluster, and reports the size the
+// kernel sees.
+type DeviceSizer interface {
+	// Rescan asks the kernel to read the capacity of the disk again.
+	Rescan(devicePath string) error
+	// Size returns the size of the device in bytes.
+	Size(devicePath string) (int64, error)
+}
+
+var NewDeviceSizer = func() DeviceSizer {
+	return &sysfsDeviceSizer{sysDir: sysDir}
+}
+
+// sysfsDeviceSizer rescans SCSI disks through the rescan attribute of their SCSI device. virtio disks have none, the
+// kernel reads their capacity again when the hypervisor signals the change.
+type sysfsDeviceSizer struct {
+	sysDir string
+}
+
+func (s *sysfsDeviceSizer) Rescan(devicePath string) error {
+	rescan := filepath.Join(s.blockDir(devicePath), "device", "rescan")
+	if _, err := os.Stat(rescan); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return os.WriteFile(rescan, []byte("1"), 0200)
+}
+
+func (s *sysfsDeviceSizer) Size(devicePath string) (int64, error) {
+	out, err := os.ReadFile(filepath.Join(s.blockDir(devicePath), "size"))
+	if err != nil {
+		return 0, err
+	}
+	sectors, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size of device %s: %w", devicePath, err)
+	}
+	// sysfs reports the size in 512 byte sectors, whatever the block size of the device.
+	return sectors * 512, nil
+}
+
+// blockDir returns the sysfs directory of the device. Device nodes outside /dev, like the bind mounts of block
+// volumes, are found by their device number.
+func (s *sysfsDeviceSizer) blockDir(devicePath string) string {
+	if resolved, err := filepath.EvalSymlinks(devicePath); err == nil {
+		devicePath = resolved
+	}
+	var stat unix.Stat_t
+	if err := unix.Stat(devicePath, &stat); err == nil && stat.Mode&unix.S_IFMT == unix.S_IFBLK {
+		return filepath.Join(s.sysDir, "dev", "block", fmt.Sprintf("%d:%d", unix.Major(stat.Rdev), unix.Minor(stat.Rdev)))
+	}
+	return filepath.Join(s.sysDir, "class", "block", filepath.Base(devicePath))
+}
+
+// waitForDeviceSize rescans the disk of an expanded volume and waits up to deviceWaitTimeout for the kernel to report
+// at least requiredBytes. It returns Unavailable if the disk doesn't grow in time, so kubelet retries the expansion,
+// and the size of the disk otherwise.
+func (n *NodeService) waitForDeviceSize(ctx context.Context, volumeID, devicePath string, requiredBytes int64) (int64, error) {
+	if n.deviceSizer == nil || devicePath == "" {
+		return 0, nil
+	}
+	var size int64
+	var err error
+	grown := func(ctx context.Context) (bool, error) {
+		// Rescan every time, the hypervisor may not have resized the disk yet when the first rescan runs.
+		if rescanErr := n.deviceSizer.Rescan(devicePath); rescanErr != nil {
+			klog.Warningf("Failed to rescan device %s: %v", devicePath, rescanErr)
+		}
+		size, err = n.deviceSizer.Size(devicePath)
+		return err != nil || size >= requiredBytes, nil
+	}
+	klog.V(3).Infof("Rescanning device %s of volume %s", devicePath, volumeID)
+	if done, _ := grown(ctx); !done && n.deviceWaitTimeout > 0 {
+		_ = wait.PollUntilContextTimeout(ctx, deviceWaitInterval, boundedTimeout(ctx, n.deviceWaitTimeout), false, grown)
+	}
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "failed to read the size of device %s: %v", devicePath, err)
+	}
+	if size < requiredBytes {
+		return 0, status.Errorf(codes.Unavailable, "device %s of volume %s has %d bytes, it hasn't grown to %d bytes on node %s yet", devicePath, volumeID, size, requiredBytes, n.nodeID)
+	}
+	return size, nil
+}
+
+// waitForDevice returns the device with serialID. The guest kernel may not have processed the hotplug yet when the
+// controller reports the volume attached, so when the device is missing it triggers a rescan of bus and waits up to
+// deviceWaitTimeout for it. It returns Unavailable if the device doesn't show up, so kubelet retries the call.
+func (n *NodeService) waitForDevice(ctx context.Context, serialID, bus string) (device, error) {
+	dev, err := getDeviceBySerialID(serialID, n.deviceLister)
+	if errors.Is(err, errDeviceNotFound) && n.deviceWaitTimeout > 0 {
+		if bus == "" {
+			bus = string(busDefaultValue)
+		}
+		klog.V(3).Infof("Device with serial %s not found, rescanning the %s bus", serialID, bus)
+		if n.deviceRescanner != nil {
+			if rescanErr := n.deviceRescanner.Rescan(bus); rescanErr != nil {
+				klog.Warningf("Failed to rescan the %s bus: %v", bus, rescanErr)
+			}
+		}
+		_ = wait.PollUntilContextTimeout(ctx, deviceWaitInterval, boundedTimeout(ctx, n.deviceWaitTimeout), false, func(ctx context.Context) (bool, error) {
+			dev, err = getDeviceBySerialID(serialID, n.deviceLister)
+			if errors.Is(err, errDeviceNotFound) {
+				return false, nil
+			}
+			return true, nil
+		})
+	}
+	if errors.Is(err, errDeviceNotFound) {
+		return device{}, status.Errorf(codes.Unavailable, "device with serial %s has not appeared on node %s yet, the hotplug may still be in progress", serialID, n.nodeID)
+	}
+	return dev, err
+}
+
+// ignoredDevicePrefixes are block devices that never back a hotplugged volume.
+var ignoredDevicePrefixes = []string{"loop", "ram", "zram", "dm-", "sr", "nbd"}
+
+// serialIDPrefixes are the prefixes udev puts in front of the serial in the /dev/disk/by-id links of the disks
+// KubeVirt hotplugs.
+var serialIDPrefixes = []string{"virtio-", "scsi-0QEMU_QEMU_HARDDISK_", "ata-QEMU_HARDDISK_"}
+
+// sysfsDeviceLister lists the block devices of the node from sysfs and /dev/disk/by-id, and probes their
+// filesystems itself, so the node plugin needs neither lsblk nor blkid. List returns the same JSON as
+// lsblk -nJo SERIAL,FSTYPE,NAME.
+type sysfsDeviceLister struct {
+	sysBlockDir string
+	devDir      string
+}
+
+func (l *sysfsDeviceLister) List() ([]byte, error) {
+	entries, err := os.ReadDir(l.sysBlockDir)
+	if err != nil {
+		return nil, err
+	}
+	serialsByID := l.serialsByID()
+
+	result := devices{BlockDevices: []device{}}
+	for _, entry := range entries {
+		name := entry.Name()
+		if isIgnoredDevice(name) {
+			continue
+		}
+		fstype, err := probeFilesystem(filepath.Join(l.devDir, name))
+		if err != nil {
+			// Leave the device out rather than report it without a filesystem, which would get it formatted.
+			klog.Warningf("Failed to probe the filesystem of device %s: %v", name, err)
+			continue
+		}
+		serial := l.serial(name)
+		if serial == "" {
+			serial = serialsByID[name]
+		}
+		result.BlockDevices = append(result.BlockDevices, device{
+			SerialID: serial,
+			Name:     name,
+			Fstype:   fstype,
+			Children: l.children(name),
+		})
+	}
+	return json.Marshal(result)
+}
+
+func isIgnoredDevice(name string) bool {
+	for _, prefix := range ignoredDevicePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// serial returns the serial sysfs reports for the device: virtio disks have a serial attribute, SCSI disks report it
+// in the unit serial number VPD page or at the end of a t10 WWID.
+func (l *sysfsDeviceLister) serial(name string) string {
+	deviceDir := filepath.Join(l.sysBlockDir, name)
+	if serial := readSysfsString(filepath.Join(deviceDir, "serial")); serial != "" {
+		return serial
+	}
+	if page, err := os.ReadFile(filepath.Join(deviceDir, "device", "vpd_pg80")); err == nil && len(page) > 4 {
+		// The page header is 4 bytes, the third and fourth hold the length of the serial.
+		length := int(binary.BigEndian.Uint16(page[2:4]))
+		if length > len(page)-4 {
+			length = len(page) - 4
+		}
+		if serial := strings.TrimSpace(string(bytes.Trim(page[4:4+length], "\x00"))); serial != "" {
+			return serial
+		}
+	}
+	if wwid := readSysfsString(filepath.Join(deviceDir, "device", "wwid")); strings.HasPrefix(wwid, "t10.") {
+		if fields := strings.Fields(wwid); len(fields) > 1 {
+			return fields[len(fields)-1]
+		}
+	}
+	return ""
+}
+
+// serialsByID maps device names to the serials in their /dev/disk/by-id links, for disks sysfs has no serial for.
+func (l *sysfsDeviceLister) serialsByID() map[string]string {
+	serials := map[string]string{}
+	byIDDir := filepath.Join(l.devDir, "disk", "by-id")
+	entries, err := os.ReadDir(byIDDir)
+	if err != nil {
+		klog.V(5).Infof("Failed to read %s: %v", byIDDir, err)
+		return serials
+	}
+	for _, entry := range entries {
+		id := entry.Name()
+		if strings.Contains(id, "-part") {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(byIDDir, id))
+		if err != nil {
+			continue
+		}
+		for _, prefix := range serialIDPrefixes {
+			if serial := strings.TrimPrefix(id, prefix); serial != id && serial != "" {
+				serials[filepath.Base(target)] = serial
+				break
+			}
+		}
+	}
+	return serials
+}
+
+// children returns the partitions of the device and the device mapper devices, like LUKS mappings, on top of it.
+// Device mapper devices are named after their mapping, as lsblk does.
+func (l *sysfsDeviceLister) children(name string) []device {
+	var children []device
+	deviceDir := filepath.Join(l.sysBlockDir, name)
+	entries, _ := os.ReadDir(deviceDir)
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join(deviceDir, entry.Name(), "partition")); err != nil {
+			continue
+		}
+		children = append(children, l.child(entry.Name(), entry.Name()))
+	}
+	holders, _ := os.ReadDir(filepath.Join(deviceDir, "holders"))
+	for _, holder := range holders {
+		dmName := readSysfsString(filepath.Join(l.sysBlockDir, holder.Name(), "dm", "name"))
+		if dmName == "" {
+			dmName = holder.Name()
+		}
+		children = append(children, l.child(holder.Name(), dmName))
+	}
+	return children
+}
+
+func (l *sysfsDeviceLister) child(kernelName, name string) device {
+	fstype, err := probeFilesystem(filepath.Join(l.devDir, kernelName))
+	if err != nil {
+		klog.Warningf("Failed to probe the filesystem of device %s: %v", kernelName, err)
+	}
+	return device{Name: name, Fstype: fstype}
+}
+
+func readSysfsString(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// filesystemMagic is a superblock signature, the same blkid looks for.
+type filesystemMagic struct {
+	fstype string
+	offset int64
+	magic  []byte
+}
+
+var filesystemMagics = []filesystemMagic{
+	{fstype: "crypto_LUKS", offset: 0, magic: []byte("LUKS\xba\xbe")},
+	{fstype: "xfs", offset: 0, magic: []byte("XFSB")},
+	{fstype: "btrfs", offset: 0x10040, magic: []byte("_BHRfS_M")},
+	{fstype: "vfat", offset: 82, magic: []byte("FAT32   ")},
+	{fstype: "vfat", offset: 54, magic: []byte("FAT16   ")},
+	{fstype: "vfat", offset: 54, magic: []byte("FAT12   ")},
+}
+
+// dataSignatures are signatures of data that isn't a filesystem the driver mounts, like volume manager metadata and
+// partition tables, named as blkid names them. A device holding one is neither formatted nor mounted.
+var dataSignatures = []filesystemMagic{
+	{fstype: "LVM2_member", offset: 0x218, magic: []byte("LVM2 001")},
+	{fstype: "swap", offset: 4086, magic: []byte("SWAPSPACE2")},
+	{fstype: "linux_raid_member", offset: 0x1000, magic: []byte{0xfc, 0x4e, 0x2b, 0xa9}},
+	{fstype: "linux_raid_member", offset: 0, magic: []byte{0xfc, 0x4e, 0x2b, 0xa9}},
+	{fstype: "gpt", offset: 512, magic: []byte("EFI PART")},
+	{fstype: "ntfs", offset: 3, magic: []byte("NTFS    ")},
+	{fstype: "iso9660", offset: 0x8001, magic: []byte("CD001")},
+	{fstype: "squashfs", offset: 0, magic: []byte("hsqs")},
+	{fstype: "f2fs", offset: 1024, magic: []byte{0x10, 0x20, 0xf5, 0xf2}},
+	{fstype: "dos", offset: 510, magic: []byte{0x55, 0xaa}},
+}
+
+const (
+	// unknownSignature is reported for devices that aren't blank but hold no signature the driver knows, like the
+	// members of ZFS pools or RAID arrays with their metadata at the end of the device.
+	unknownSignature = "unknown"
+	// blankProbeSize is how much of the start and the end of a device has to be zeroes for it to count as blank. It
+	// covers the signatures blkid finds at either end of a device.
+	blankProbeSize = 1024 * 1024
+)
+
+const (
+	extSuperblockOffset = 1024
+	extMagic            = 0xEF53
+	// ext feature flags that tell ext4 and ext3 apart from ext2.
+	extFeatureCompatHasJournal = 0x4
+	extFeatureIncompatExtents  = 0x40
+	extFeatureIncompat64Bit    = 0x80
+	extFeatureIncompatFlexBg   = 0x200
+)
+
+// probeFilesystem returns the filesystem on the device at path, or an empty string when the device is blank. Devices
+// that hold other data are reported with the name of its signature, or unknownSignature, so they are never formatted.
+func probeFilesystem(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fstype, err := probeMagics(f, filesystemMagics)
+	if err != nil || fstype != "" {
+		return fstype, err
+	}
+	if fstype, err = probeExt(f); err != nil || fstype != "" {
+		return fstype, err
+	}
+	if fstype, err = probeMagics(f, dataSignatures); err != nil || fstype != "" {
+		return fstype, err
+	}
+	blank, err := isBlank(f)
+	if err != nil || blank {
+		return "", err
+	}
+	return unknownSignature, nil
+}
+
+// requestedOnlyFilesystems are filesystems whose signature is also written by partitioning tools and firmware images,
+// like the FAT header of an EFI system partition. A device holding one is only mounted when the volume asks for that
+// filesystem.
+var requestedOnlyFilesystems = []string{"vfat"}
+
+// isForeignFilesystem tells whether fstype is a filesystem the driver only mounts when the volume asks for it, and the
+// volume asks for requestedFsType instead.
+func isForeignFilesystem(fstype, requestedFsType string) bool {
+	return slices.Contains(requestedOnlyFilesystems, fstype) && fstype != requestedFsType
+}
+
+// isDataSignature tells whether fstype names data the driver must neither format nor mount.
+func isDataSignature(fstype string) bool {
+	if fstype == unknownSignature {
+		return true
+	}
+	for _, m := range dataSignatures {
+		if m.fstype == fstype {
+			return true
+		}
+	}
+	return false
+}
+
+func probeMagics(f io.ReaderAt, magics []filesystemMagic) (string, error) {
+	for _, m := range magics {
+		buf := make([]byte, len(m.magic))
+		ok, err := readAt(f, buf, m.offset)
+		if err != nil {
+			return "", err
+		}
+		if ok && bytes.Equal(buf, m.magic) {
+			return m.fstype, nil
+		}
+	}
+	return "", nil
+}
+
+// isBlank tells whether the first and the last blankProbeSize bytes of the device are zeroes.
+func isBlank(f *os.File) (bool, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	buf := make([]byte, 64*1024)
+	for _, start := range []int64{0, max(size-blankProbeSize, 0)} {
+		end := min(start+blankProbeSize, size)
+		for offset := start; offset < end; offset += int64(len(buf)) {
+			n, err := f.ReadAt(buf[:min(int64(len(buf)), end-offset)], offset)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return false, err
+			}
+			if slices.ContainsFunc(buf[:n], func(b byte) bool { return b != 0 }) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func probeExt(f io.ReaderAt) (string, error) {
+	superblock := make([]byte, 0x68)
+	ok, err := readAt(f, superblock, extSuperblockOffset)
+	if err != nil || !ok {
+		return "", err
+	}
+	if binary.LittleEndian.Uint16(superblock[0x38:]) != extMagic {
+		return "", nil
+	}
+	compat := binary.LittleEndian.Uint32(superblock[0x5c:])
+	incompat := binary.LittleEndian.Uint32(superblock[0x60:])
+	switch {
+	case incompat&(extFeatureIncompatExtents|extFeatureIncompat64Bit|extFeatureIncompatFlexBg) != 0:
+		return "ext4", nil
+	case compat&extFeatureCompatHasJournal != 0:
+		return "ext3", nil
+	default:
+		return "ext2", nil
+	}
+}
+
+// readAt fills buf from offset, it returns false when the device is too small to hold it.
+func readAt(f io.ReaderAt, buf []byte, offset int64) (bool, error) {
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
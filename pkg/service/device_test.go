@@ -0,0 +1,246 @@
+package service
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("sysfsDeviceLister", func() {
+	var (
+		sysDir    string
+		devDir    string
+		underTest *sysfsDeviceLister
+	)
+
+	writeFile := func(path string, content []byte) {
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, content, 0644)).To(Succeed())
+	}
+
+	// addDevice creates the sysfs directory of a block device and its device node holding the first bytes of content.
+	addDevice := func(name string, content []byte) {
+		Expect(os.MkdirAll(filepath.Join(sysDir, name), 0755)).To(Succeed())
+		writeFile(filepath.Join(devDir, name), append(content, make([]byte, 8192)...))
+	}
+
+	withExt := func(compat, incompat uint32) []byte {
+		superblock := make([]byte, 2048)
+		binary.LittleEndian.PutUint16(superblock[1024+0x38:], extMagic)
+		binary.LittleEndian.PutUint32(superblock[1024+0x5c:], compat)
+		binary.LittleEndian.PutUint32(superblock[1024+0x60:], incompat)
+		return superblock
+	}
+
+	BeforeEach(func() {
+		sysDir = GinkgoT().TempDir()
+		devDir = GinkgoT().TempDir()
+		underTest = &sysfsDeviceLister{sysBlockDir: sysDir, devDir: devDir}
+	})
+
+	It("should find virtio disks by their serial attribute", func() {
+		addDevice("vdb", withExt(extFeatureCompatHasJournal, extFeatureIncompatExtents))
+		writeFile(filepath.Join(sysDir, "vdb", "serial"), []byte(serialID+"\n"))
+
+		dev, err := getDeviceBySerialID(serialID, underTest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dev.Name).To(Equal("vdb"))
+		Expect(dev.Path).To(Equal("/dev/vdb"))
+		Expect(dev.Fstype).To(Equal("ext4"))
+	})
+
+	It("should find SCSI disks by their unit serial number VPD page", func() {
+		addDevice("sdb", []byte("XFSB"))
+		page := []byte{0, 0x80, 0, byte(len(serialID))}
+		writeFile(filepath.Join(sysDir, "sdb", "device", "vpd_pg80"), append(page, serialID...))
+
+		dev, err := getDeviceBySerialID(serialID, underTest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dev.Name).To(Equal("sdb"))
+		Expect(dev.Fstype).To(Equal("xfs"))
+	})
+
+	It("should find SCSI disks by their t10 WWID", func() {
+		addDevice("sdc", nil)
+		writeFile(filepath.Join(sysDir, "sdc", "device", "wwid"), []byte("t10.QEMU    QEMU HARDDISK    "+serialID+"\n"))
+
+		dev, err := getDeviceBySerialID(serialID, underTest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dev.Name).To(Equal("sdc"))
+		Expect(dev.Fstype).To(BeEmpty())
+	})
+
+	It("should fall back to the by-id links", func() {
+		addDevice("sdd", withExt(0, 0))
+		Expect(os.MkdirAll(filepath.Join(devDir, "disk", "by-id"), 0755)).To(Succeed())
+		Expect(os.Symlink("../../sdd", filepath.Join(devDir, "disk", "by-id", "scsi-0QEMU_QEMU_HARDDISK_"+serialID))).To(Succeed())
+		Expect(os.Symlink("../../sdd1", filepath.Join(devDir, "disk", "by-id", "scsi-0QEMU_QEMU_HARDDISK_"+serialID+"-part1"))).To(Succeed())
+
+		dev, err := getDeviceBySerialID(serialID, underTest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dev.Name).To(Equal("sdd"))
+		Expect(dev.Fstype).To(Equal("ext2"))
+	})
+
+	It("should report LUKS devices and their mappings", func() {
+		addDevice("sde", []byte("LUKS\xba\xbe"))
+		writeFile(filepath.Join(sysDir, "sde", "serial"), []byte(serialID))
+		addDevice("dm-0", withExt(extFeatureCompatHasJournal, 0))
+		writeFile(filepath.Join(sysDir, "dm-0", "dm", "name"), []byte("luks-pvc-123\n"))
+		Expect(os.MkdirAll(filepath.Join(sysDir, "sde", "holders", "dm-0"), 0755)).To(Succeed())
+
+		dev, err := getDeviceBySerialID(serialID, underTest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dev.Fstype).To(Equal("crypto_LUKS"))
+
+		mapped, err := getMappedDevice(serialID, "luks-pvc-123", underTest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mapped.Path).To(Equal(devMapperDir + "luks-pvc-123"))
+		Expect(mapped.Fstype).To(Equal("ext3"))
+	})
+
+	DescribeTable("should report data that isn't a filesystem", func(content []byte, atEnd bool, expected string) {
+		device := make([]byte, 4*blankProbeSize)
+		if atEnd {
+			copy(device[len(device)-len(content):], content)
+		} else {
+			copy(device, content)
+		}
+		writeFile(filepath.Join(devDir, "sdg"), device)
+		writeFile(filepath.Join(sysDir, "sdg", "serial"), []byte(serialID))
+
+		dev, err := getDeviceBySerialID(serialID, underTest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dev.Fstype).To(Equal(expected))
+		Expect(isDataSignature(dev.Fstype)).To(BeTrue())
+	},
+		Entry("LVM physical volume", withSignature(0x218, "LVM2 001"), false, "LVM2_member"),
+		Entry("GPT partition table", withSignature(512, "EFI PART"), false, "gpt"),
+		Entry("MBR partition table", withSignature(510, "\x55\xaa"), false, "dos"),
+		Entry("swap space", withSignature(4086, "SWAPSPACE2"), false, "swap"),
+		Entry("unknown data at the start", []byte("some data"), false, unknownSignature),
+		Entry("unknown data at the end", []byte("RAID metadata"), true, unknownSignature),
+	)
+
+	It("should report blank devices without a filesystem", func() {
+		writeFile(filepath.Join(devDir, "sdg"), make([]byte, 4*blankProbeSize))
+		writeFile(filepath.Join(sysDir, "sdg", "serial"), []byte(serialID))
+
+		dev, err := getDeviceBySerialID(serialID, underTest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dev.Fstype).To(BeEmpty())
+	})
+
+	It("should leave out devices it can't probe", func() {
+		Expect(os.MkdirAll(filepath.Join(sysDir, "sdf"), 0755)).To(Succeed())
+		writeFile(filepath.Join(sysDir, "sdf", "serial"), []byte(serialID))
+
+		_, err := getDeviceBySerialID(serialID, underTest)
+		Expect(err).To(MatchError("couldn't find device by serial id"))
+	})
+})
+
+// withSignature returns the start of a device holding magic at offset.
+func withSignature(offset int, magic string) []byte {
+	content := make([]byte, offset+len(magic))
+	copy(content[offset:], magic)
+	return content
+}
+
+var _ = Describe("sysfsDeviceRescanner", func() {
+	var (
+		sysDir    string
+		underTest *sysfsDeviceRescanner
+	)
+
+	BeforeEach(func() {
+		sysDir = GinkgoT().TempDir()
+		underTest = &sysfsDeviceRescanner{sysDir: sysDir}
+		Expect(os.MkdirAll(filepath.Join(sysDir, "bus", "pci"), 0755)).To(Succeed())
+		for _, host := range []string{"host0", "host1"} {
+			Expect(os.MkdirAll(filepath.Join(sysDir, "class", "scsi_host", host), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(sysDir, "class", "scsi_host", host, "scan"), nil, 0200)).To(Succeed())
+		}
+	})
+
+	It("should scan all SCSI hosts for scsi disks", func() {
+		Expect(underTest.Rescan("scsi")).To(Succeed())
+		for _, host := range []string{"host0", "host1"} {
+			Expect(os.ReadFile(filepath.Join(sysDir, "class", "scsi_host", host, "scan"))).To(BeEquivalentTo("- - -"))
+		}
+		Expect(filepath.Join(sysDir, "bus", "pci", "rescan")).ToNot(BeAnExistingFile())
+	})
+
+	It("should rescan the PCI bus for virtio disks", func() {
+		Expect(underTest.Rescan("virtio")).To(Succeed())
+		Expect(os.ReadFile(filepath.Join(sysDir, "bus", "pci", "rescan"))).To(BeEquivalentTo("1"))
+	})
+})
+
+var _ = Describe("readFilesystemUUID", func() {
+	It("should read the UUID from the superblock", func() {
+		superblock := make([]byte, 2048)
+		copy(superblock[extSuperblockOffset+0x68:], []byte{0x4b, 0x13, 0xce, 0xbc, 0x74, 0x06, 0x4c, 0x19, 0x88, 0x32, 0x7f, 0xcb, 0x1d, 0x4a, 0xc8, 0xc5})
+		path := filepath.Join(GinkgoT().TempDir(), "sdc")
+		Expect(os.WriteFile(path, superblock, 0644)).To(Succeed())
+
+		fsUUID, err := readFilesystemUUID(path, "ext4")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fsUUID).To(Equal("4b13cebc-7406-4c19-8832-7fcb1d4ac8c5"))
+	})
+
+	It("should not read the UUID of unknown filesystems", func() {
+		fsUUID, err := readFilesystemUUID("/nonexistent", "vfat")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fsUUID).To(BeEmpty())
+	})
+})
+
+var _ = Describe("sysfsDeviceReleaser", func() {
+	It("should find the holders of the device and its partitions", func() {
+		sysDir := GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(sysDir, "sdc", "holders", "dm-0"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(sysDir, "sdc", "sdc1", "holders", "dm-1"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(sysDir, "sdd", "holders"), 0755)).To(Succeed())
+		underTest := &sysfsDeviceReleaser{sysBlockDir: sysDir}
+
+		Expect(underTest.Holders("/dev/sdc")).To(ConsistOf("dm-0", "dm-1"))
+		Expect(underTest.Holders("/dev/sdd")).To(BeEmpty())
+		Expect(underTest.Holders("/dev/sde")).To(BeEmpty())
+	})
+})
+
+var _ = Describe("sysfsDeviceSizer", func() {
+	var (
+		sysDir    string
+		underTest *sysfsDeviceSizer
+	)
+
+	BeforeEach(func() {
+		sysDir = GinkgoT().TempDir()
+		underTest = &sysfsDeviceSizer{sysDir: sysDir}
+		Expect(os.MkdirAll(filepath.Join(sysDir, "class", "block", "sdc", "device"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(sysDir, "class", "block", "sdc", "size"), []byte("4194304\n"), 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(sysDir, "class", "block", "vdb"), 0755)).To(Succeed())
+	})
+
+	It("should report the size of the device in bytes", func() {
+		Expect(underTest.Size(filepath.Join(sysDir, "sdc"))).To(Equal(int64(2 << 30)))
+		_, err := underTest.Size(filepath.Join(sysDir, "sdd"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should rescan SCSI disks", func() {
+		rescan := filepath.Join(sysDir, "class", "block", "sdc", "device", "rescan")
+		Expect(os.WriteFile(rescan, nil, 0644)).To(Succeed())
+		Expect(underTest.Rescan(filepath.Join(sysDir, "sdc"))).To(Succeed())
+		Expect(os.ReadFile(rescan)).To(Equal([]byte("1")))
+	})
+
+	It("should not rescan virtio disks", func() {
+		Expect(underTest.Rescan(filepath.Join(sysDir, "vdb"))).To(Succeed())
+	})
+})
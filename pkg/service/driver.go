@@ -43,21 +43,32 @@ func (d *KubevirtCSIDriver) WithControllerService(
 	infraClusterNamespace string,
 	infraClusterLabels map[string]string,
 	storageClassEnforcement util.StorageClassEnforcement,
+	allowedNamespaces []string,
+	vmOwnership VMOwnership,
+	timeouts ControllerTimeouts,
+	maxVolumesPerNode int64,
 ) *KubevirtCSIDriver {
 	d.ControllerService = NewControllerService(
 		virtClient,
 		infraClusterNamespace,
 		infraClusterLabels,
 		storageClassEnforcement,
+		allowedNamespaces,
+		vmOwnership,
+		timeouts,
+		maxVolumesPerNode,
 	)
 	return d
 }
 
-// WithNodeService creates a NodeService targeting the provided node.
+// WithNodeService creates a NodeService targeting the provided node. Events about the volumes of the node are
+// recorded with eventRecorder when it is set.
 func (d *KubevirtCSIDriver) WithNodeService(
 	nodeID string,
+	maxVolumesPerNode int64,
+	eventRecorder VolumeEventRecorder,
 ) *KubevirtCSIDriver {
-	d.NodeService = NewNodeService(nodeID)
+	d.NodeService = NewNodeService(nodeID, maxVolumesPerNode, eventRecorder)
 	return d
 }
 
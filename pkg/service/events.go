@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// eventNamespace holds the events of PersistentVolumes, which aren't namespaced.
+	eventNamespace = metav1.NamespaceDefault
+	// maxEventMessageLength keeps events under the size limit of the API server.
+	maxEventMessageLength = 1024
+	eventTimeout          = 10 * time.Second
+)
+
+// VolumeEventRecorder records events about volumes in the tenant cluster, so that users see what the node did to
+// their volumes with kubectl describe pv.
+type VolumeEventRecorder interface {
+	Event(volumeID, eventType, reason, message string)
+}
+
+// NewVolumeEventRecorder returns a VolumeEventRecorder that creates the events with the tenant client. The name part
+// of the volume ID is the name of the PersistentVolume.
+func NewVolumeEventRecorder(tenantClient kubernetes.Interface, nodeName string) VolumeEventRecorder {
+	return &volumeEventRecorder{client: tenantClient, nodeName: nodeName}
+}
+
+type volumeEventRecorder struct {
+	client   kubernetes.Interface
+	nodeName string
+}
+
+func (r *volumeEventRecorder) Event(volumeID, eventType, reason, message string) {
+	if len(message) > maxEventMessageLength {
+		message = message[:maxEventMessageLength-3] + "..."
+	}
+	name := volumeName(volumeID)
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: name + ".",
+			Namespace:    eventNamespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "PersistentVolume",
+			Name:       name,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: VendorName, Host: r.nodeName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	if _, err := r.client.CoreV1().Events(eventNamespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		klog.Warningf("Failed to record event %s for volume %s: %v", reason, volumeID, err)
+	}
+}
+
+// recordEvent records an event about the volume if the node service has an event recorder.
+func (n *NodeService) recordEvent(volumeID, eventType, reason, message string) {
+	if n.eventRecorder != nil {
+		n.eventRecorder.Event(volumeID, eventType, reason, message)
+	}
+}
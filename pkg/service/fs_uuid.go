@@ -0,0 +1,172 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	klog "k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	// contentSourceParameter tells the node that the volume was restored from a snapshot or cloned from another
+	// volume, so its filesystem is a copy of the filesystem of the source, UUID included.
+	contentSourceParameter = "contentSource"
+	contentSourceSnapshot  = "snapshot"
+	contentSourceVolume    = "volume"
+)
+
+// filesystemUUIDOffsets are the offsets of the UUID in the superblocks of the filesystems whose UUID the node
+// regenerates.
+var filesystemUUIDOffsets = map[string]int64{
+	"xfs":  32,
+	"ext2": extSuperblockOffset + 0x68,
+	"ext3": extSuperblockOffset + 0x68,
+	"ext4": extSuperblockOffset + 0x68,
+}
+
+// FsUUIDChanger reads and changes the UUID of a filesystem that isn't mounted.
+type FsUUIDChanger interface {
+	UUID(device, fsType string) (string, error)
+	SetUUID(device, fsType, uuid string) error
+}
+
+var NewFsUUIDChanger = func() FsUUIDChanger {
+	exec := utilexec.New()
+	return &fsUUIDChanger{exec: exec, checker: &fsChecker{exec: exec}}
+}
+
+type fsUUIDChanger struct {
+	exec    utilexec.Interface
+	checker FsChecker
+}
+
+func (c *fsUUIDChanger) UUID(device, fsType string) (string, error) {
+	return readFilesystemUUID(device, fsType)
+}
+
+func (c *fsUUIDChanger) SetUUID(device, fsType, uuid string) error {
+	var command string
+	switch fsType {
+	case "xfs":
+		command = "xfs_admin"
+	case "ext2", "ext3", "ext4":
+		// tune2fs refuses to change the UUID of filesystems with metadata checksums, the default of ext4, unless they
+		// were freshly checked, and of filesystems whose journal needs recovery, which it does on snapshots of
+		// mounted volumes. Repairing the filesystem replays the journal and only fixes what is safe to fix unattended.
+		if output, err := c.checker.Check(device, fsType, true); err != nil {
+			return fmt.Errorf("%w: %s", err, output)
+		}
+		command = "tune2fs"
+	default:
+		return fmt.Errorf("changing the UUID of %s filesystems is not supported", fsType)
+	}
+	klog.V(3).Infof("Changing the UUID of the %s filesystem on %s to %s", fsType, device, uuid)
+	out, err := c.exec.Command(command, "-U", uuid, device).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", command, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// readFilesystemUUID reads the UUID from the superblock of the filesystem on the device at path. It returns an empty
+// string for filesystems it doesn't know the superblock of.
+func readFilesystemUUID(path, fsType string) (string, error) {
+	offset, ok := filesystemUUIDOffsets[fsType]
+	if !ok {
+		return "", nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 16)
+	if ok, err := readAt(f, buf, offset); err != nil || !ok {
+		return "", err
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16]), nil
+}
+
+// hasOwnFilesystemUUID tells whether the UUID of the filesystem is the serial of the volume, which the node sets when
+// it regenerates the UUID of a restored or cloned volume.
+func (n *NodeService) hasOwnFilesystemUUID(device device, serialID string) bool {
+	if n.fsUUIDChanger == nil || serialID == "" {
+		return false
+	}
+	fsUUID, err := n.fsUUIDChanger.UUID(device.Path, device.Fstype)
+	if err != nil {
+		klog.Warningf("Failed to read the filesystem UUID of %s: %v", device.Path, err)
+		return false
+	}
+	return strings.EqualFold(fsUUID, serialID)
+}
+
+// regenerateFilesystemUUID gives the filesystem of a volume that was restored from a snapshot or cloned a UUID of its
+// own, so it no longer clashes with the filesystem of its source. The new UUID is the serial of the volume, the UID of
+// its DataVolume, so the filesystem itself records that it was done and it isn't repeated when the volume is staged
+// again, on this node or another. It returns whether the filesystem has its own UUID. A failure to change the UUID is
+// reported as an event and fails staging, rather than mounting a filesystem whose UUID clashes with its source.
+func (n *NodeService) regenerateFilesystemUUID(req *csi.NodeStageVolumeRequest, device device) (bool, error) {
+	serialID := req.VolumeContext[serialParameter]
+	if _, ok := filesystemUUIDOffsets[device.Fstype]; !ok || n.fsUUIDChanger == nil {
+		return false, nil
+	}
+	if n.hasOwnFilesystemUUID(device, serialID) {
+		return true, nil
+	}
+	if req.VolumeContext[contentSourceParameter] == "" || isReadOnlyCapability(req.VolumeCapability) {
+		return false, nil
+	}
+	if err := uuid.Validate(serialID); err != nil {
+		klog.Warningf("Not changing the filesystem UUID of volume %s, serial %q is not a UUID", req.VolumeId, serialID)
+		return false, nil
+	}
+	mounted, err := n.deviceMounted(device.Path)
+	if err != nil || mounted {
+		return false, err
+	}
+
+	if device.Fstype == "xfs" {
+		// xfs_admin refuses to change the UUID while the log is dirty, which it is on snapshots of mounted volumes.
+		// Mounting the filesystem replays the log.
+		stagingPath := req.GetStagingTargetPath()
+		if err := n.dirMaker.Make(stagingPath, 0750); err != nil {
+			return false, err
+		}
+		if err := n.mounter.Mount(device.Path, stagingPath, device.Fstype, []string{"nouuid"}); err != nil {
+			return false, err
+		}
+		if err := n.mounter.Unmount(stagingPath); err != nil {
+			return false, err
+		}
+	}
+	if err := n.fsUUIDChanger.SetUUID(device.Path, device.Fstype, serialID); err != nil {
+		n.recordEvent(req.VolumeId, corev1.EventTypeWarning, "FilesystemUUIDNotChanged",
+			fmt.Sprintf("failed to give the %s filesystem on %s a new UUID: %v", device.Fstype, n.nodeID, err))
+		return false, status.Errorf(codes.Internal, "failed to change the filesystem UUID of volume %s: %v", req.VolumeId, err)
+	}
+	n.recordEvent(req.VolumeId, corev1.EventTypeNormal, "FilesystemUUIDChanged",
+		fmt.Sprintf("%s filesystem copied from a %s has the new UUID %s", device.Fstype, req.VolumeContext[contentSourceParameter], serialID))
+	return true, nil
+}
+
+func isReadOnlyCapability(capability *csi.VolumeCapability) bool {
+	switch capability.GetAccessMode().GetMode() {
+	case csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY, csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY:
+		return true
+	}
+	for _, flag := range capability.GetMount().GetMountFlags() {
+		if flag == "ro" {
+			return true
+		}
+	}
+	return false
+}
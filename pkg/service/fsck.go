@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	klog "k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	// fsckPolicyParameter selects whether the node checks or repairs an existing filesystem before it mounts it.
+	fsckPolicyParameter = "fsckPolicy"
+	fsckPolicyNone      = "none"
+	fsckPolicyCheck     = "check"
+	fsckPolicyRepair    = "repair"
+)
+
+var fsckPolicies = []string{fsckPolicyNone, fsckPolicyCheck, fsckPolicyRepair}
+
+// FsChecker checks, and optionally repairs, the filesystem on a device that isn't mounted. It returns the output of
+// the check, and an error if the filesystem is corrupt.
+type FsChecker interface {
+	Check(device, fsType string, repair bool) (string, error)
+}
+
+var NewFsChecker = func() FsChecker {
+	return &fsChecker{exec: utilexec.New()}
+}
+
+// fsChecker runs the check tools of the filesystems. SafeFormatAndMount always repairs ext filesystems when it mounts
+// them, and has no way to only check them.
+type fsChecker struct {
+	exec utilexec.Interface
+}
+
+func (c *fsChecker) Check(device, fsType string, repair bool) (string, error) {
+	var command string
+	var args []string
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		// -f checks filesystems that are marked clean too, tune2fs relies on it before it changes their UUID.
+		command, args = "e2fsck", []string{"-f", "-p", device}
+		if !repair {
+			// A read-only check can't replay the journal and reports the filesystem of volumes that weren't unmounted
+			// cleanly, like those restored from a snapshot, as corrupt. Mounting would replay it anyway.
+			if out, err := c.replayJournal(device); err != nil {
+				return out, err
+			}
+			args = []string{"-f", "-n", device}
+		}
+	case "xfs":
+		command, args = "xfs_repair", []string{"-n", device}
+		if repair {
+			args = []string{device}
+		}
+	case "btrfs":
+		// btrfs check --repair isn't safe to run unattended, btrfs volumes are only checked.
+		command, args = "btrfs", []string{"check", "--readonly", device}
+	default:
+		return "", nil
+	}
+
+	klog.V(3).Infof("Checking filesystem %s on %s: %s %s", fsType, device, command, strings.Join(args, " "))
+	out, err := c.exec.Command(command, args...).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	var exitErr utilexec.ExitError
+	if err != nil && errors.As(err, &exitErr) {
+		switch {
+		case command == "e2fsck" && exitErr.ExitStatus() < 4:
+			// 1 and 2 mean that errors were corrected.
+			return output, nil
+		case command == "xfs_repair" && exitErr.ExitStatus() == 2:
+			// The log is dirty, mounting the filesystem replays it.
+			return output, nil
+		}
+	}
+	if err != nil {
+		return output, fmt.Errorf("%s failed: %w", command, err)
+	}
+	return output, nil
+}
+
+// replayJournal replays the journal of the ext filesystem on device, without checking the filesystem.
+func (c *fsChecker) replayJournal(device string) (string, error) {
+	klog.V(3).Infof("Replaying the journal of the ext filesystem on %s", device)
+	out, err := c.exec.Command("e2fsck", "-p", "-E", "journal_only", device).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	var exitErr utilexec.ExitError
+	if err != nil && errors.As(err, &exitErr) && exitErr.ExitStatus() < 4 {
+		// 1 means that the journal was replayed.
+		return output, nil
+	}
+	if err != nil {
+		return output, fmt.Errorf("e2fsck failed to replay the journal: %w", err)
+	}
+	return output, nil
+}
+
+func fsckPolicy(volumeContext map[string]string) (string, error) {
+	policy := volumeContext[fsckPolicyParameter]
+	if policy == "" {
+		return fsckPolicyNone, nil
+	}
+	if !slices.Contains(fsckPolicies, policy) {
+		return "", status.Errorf(codes.InvalidArgument, "invalid %s %q, must be one of %s", fsckPolicyParameter, policy, strings.Join(fsckPolicies, ", "))
+	}
+	return policy, nil
+}
+
+// checkFilesystem checks, or repairs, the existing filesystem of the volume before it is mounted for the first time,
+// according to policy. Devices that are mounted already are not checked. It returns FailedPrecondition if the
+// filesystem is corrupt, so a damaged volume is never mounted.
+func (n *NodeService) checkFilesystem(volumeID string, device device, policy string) error {
+	if policy == fsckPolicyNone || n.fsChecker == nil {
+		return nil
+	}
+	if mounted, err := n.deviceMounted(device.Path); err != nil {
+		return err
+	} else if mounted {
+		klog.V(3).Infof("Not checking the filesystem of volume %s, %s is mounted", volumeID, device.Path)
+		return nil
+	}
+
+	repair := policy == fsckPolicyRepair
+	output, err := n.fsChecker.Check(device.Path, device.Fstype, repair)
+	if err != nil {
+		n.recordEvent(volumeID, corev1.EventTypeWarning, "FilesystemCheckFailed",
+			fmt.Sprintf("%s filesystem on %s failed the check: %v: %s", device.Fstype, n.nodeID, err, output))
+		return status.Errorf(codes.FailedPrecondition, "%s filesystem of volume %s failed the check, refusing to mount it: %v", device.Fstype, volumeID, err)
+	}
+	action := "checked"
+	if repair {
+		action = "checked and repaired where needed"
+	}
+	n.recordEvent(volumeID, corev1.EventTypeNormal, "FilesystemChecked", fmt.Sprintf("%s filesystem %s on %s: %s", device.Fstype, action, n.nodeID, output))
+	return nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+	klog "k8s.io/klog/v2"
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	// discardParameter selects how deleted data of filesystem volumes is returned to thin provisioned infra storage.
+	discardParameter = "discard"
+	discardNone      = "none"
+	// discardOnline mounts the filesystem with the discard option, which discards blocks as soon as they are freed.
+	discardOnline = "online"
+	// discardFstrim runs fstrim on the filesystem periodically, which is cheaper than discarding every freed block.
+	discardFstrim = "fstrim"
+
+	// DefaultFstrimInterval is how often the node trims the filesystems of volumes with the fstrim discard mode.
+	DefaultFstrimInterval = 24 * time.Hour
+)
+
+var discardModes = []string{discardNone, discardOnline, discardFstrim}
+
+// fstrimTrimmed matches the bytes fstrim -v reports, e.g. "/mnt: 1 GiB (1073741824 bytes) trimmed".
+var fstrimTrimmed = regexp.MustCompile(`\((\d+) bytes\) trimmed`)
+
+func discardMode(parameters map[string]string) (string, error) {
+	mode := parameters[discardParameter]
+	if mode == "" {
+		return discardNone, nil
+	}
+	if !slices.Contains(discardModes, mode) {
+		return "", status.Errorf(codes.InvalidArgument, "invalid %s %q, must be one of %s", discardParameter, mode, strings.Join(discardModes, ", "))
+	}
+	return mode, nil
+}
+
+// discardMountFlags adds the discard mount flag to the flags of the staging mount of volumes with the online discard
+// mode.
+func discardMountFlags(flags []string, mode string) []string {
+	if mode != discardOnline {
+		return flags
+	}
+	return mergeMountOptions(flags, []string{"discard"})
+}
+
+// Trimmer discards the unused blocks of a mounted filesystem and returns how many bytes it discarded.
+type Trimmer interface {
+	Trim(path string) (int64, error)
+}
+
+var NewTrimmer = func() Trimmer {
+	return &fstrimTrimmer{exec: utilexec.New()}
+}
+
+type fstrimTrimmer struct {
+	exec utilexec.Interface
+}
+
+func (t *fstrimTrimmer) Trim(path string) (int64, error) {
+	out, err := t.exec.Command("fstrim", "-v", path).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("fstrim failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return parseFstrimOutput(string(out))
+}
+
+func parseFstrimOutput(out string) (int64, error) {
+	match := fstrimTrimmed.FindStringSubmatch(out)
+	if match == nil {
+		return 0, fmt.Errorf("unexpected fstrim output %q", strings.TrimSpace(out))
+	}
+	return strconv.ParseInt(match[1], 10, 64)
+}
+
+// RunFstrim trims the filesystems of the staged volumes with the fstrim discard mode every interval, until ctx is
+// done.
+func (n *NodeService) RunFstrim(ctx context.Context, interval time.Duration) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		n.trimVolumes()
+	}, interval)
+}
+
+func (n *NodeService) trimVolumes() {
+	if n.stateStore == nil || n.trimmer == nil {
+		return
+	}
+	states, err := n.stateStore.List()
+	if err != nil {
+		klog.Errorf("Failed to list the staged volumes to trim: %v", err)
+		return
+	}
+	for _, state := range states {
+		if state.Discard != discardFstrim {
+			continue
+		}
+		// The volume may have been unstaged since it was saved.
+		notMnt, err := n.mounter.IsLikelyNotMountPoint(state.StagingPath)
+		if err != nil || notMnt {
+			klog.V(3).Infof("Not trimming volume %s, it isn't mounted at %s", state.VolumeID, state.StagingPath)
+			continue
+		}
+		trimmed, err := n.trimmer.Trim(state.StagingPath)
+		if err != nil {
+			klog.Errorf("Failed to trim volume %s: %v", state.VolumeID, err)
+		} else {
+			klog.V(3).Infof("Trimmed %d bytes of volume %s", trimmed, state.VolumeID)
+		}
+		n.fstrimMetrics.observe(state.VolumeID, trimmed, err)
+	}
+}
+
+// MetricsHandler serves the metrics of the node service in the Prometheus text format.
+func (n *NodeService) MetricsHandler() http.Handler {
+	return n.fstrimMetrics
+}
+
+// fstrimMetrics counts the runs of fstrim and the bytes they reclaimed, per volume and for all volumes of the node.
+type fstrimMetrics struct {
+	mu             sync.Mutex
+	reclaimedTotal int64
+	reclaimed      map[string]int64
+	runs           map[string]int64
+	failures       map[string]int64
+}
+
+func (m *fstrimMetrics) observe(volumeID string, trimmed int64, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.runs == nil {
+		m.reclaimed = map[string]int64{}
+		m.runs = map[string]int64{}
+		m.failures = map[string]int64{}
+	}
+	m.runs[volumeID]++
+	if err != nil {
+		m.failures[volumeID]++
+		return
+	}
+	m.reclaimed[volumeID] += trimmed
+	m.reclaimedTotal += trimmed
+}
+
+func (m *fstrimMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP %[1]s Bytes fstrim returned to the infra storage for all volumes of the node.\n# TYPE %[1]s counter\n%[1]s %[2]d\n",
+		"kubevirt_csi_fstrim_reclaimed_bytes_total", m.reclaimedTotal)
+	writeVolumeCounter(w, "kubevirt_csi_fstrim_volume_reclaimed_bytes_total", "Bytes fstrim returned to the infra storage per volume.", m.reclaimed)
+	writeVolumeCounter(w, "kubevirt_csi_fstrim_runs_total", "Runs of fstrim per volume.", m.runs)
+	writeVolumeCounter(w, "kubevirt_csi_fstrim_failures_total", "Runs of fstrim that failed per volume.", m.failures)
+}
+
+// writeVolumeCounter writes a counter with a volume_id label in the Prometheus text format.
+func writeVolumeCounter(w http.ResponseWriter, name, help string, values map[string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	volumeIDs := make([]string, 0, len(values))
+	for volumeID := range values {
+		volumeIDs = append(volumeIDs, volumeID)
+	}
+	sort.Strings(volumeIDs)
+	for _, volumeID := range volumeIDs {
+		fmt.Fprintf(w, "%s{volume_id=%q} %d\n", name, volumeID, values[volumeID])
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("fstrim", func() {
+	var (
+		trimmer   *fakeTrimmer
+		store     *fileStateStore
+		underTest *NodeService
+	)
+
+	BeforeEach(func() {
+		trimmer = &fakeTrimmer{trimmed: 4096}
+		store = &fileStateStore{dir: GinkgoT().TempDir()}
+		underTest = &NodeService{
+			mounter:       &successfulMounter{mounts: map[string]string{"/staging/trimmed": "/dev/sdc", "/staging/online": "/dev/sdd"}},
+			stateStore:    store,
+			trimmer:       trimmer,
+			fstrimMetrics: &fstrimMetrics{},
+		}
+		Expect(store.Save(VolumeState{VolumeID: "pvc-trimmed", StagingPath: "/staging/trimmed", Discard: discardFstrim})).To(Succeed())
+		Expect(store.Save(VolumeState{VolumeID: "pvc-online", StagingPath: "/staging/online", Discard: discardOnline})).To(Succeed())
+		Expect(store.Save(VolumeState{VolumeID: "pvc-unstaged", StagingPath: "/staging/unstaged", Discard: discardFstrim})).To(Succeed())
+	})
+
+	metrics := func() string {
+		recorder := httptest.NewRecorder()
+		underTest.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		return recorder.Body.String()
+	}
+
+	It("should only trim the mounted volumes with the fstrim discard mode", func() {
+		underTest.trimVolumes()
+		Expect(trimmer.paths).To(Equal([]string{"/staging/trimmed"}))
+	})
+
+	It("should keep trimming the other volumes when one fails", func() {
+		Expect(store.Save(VolumeState{VolumeID: "pvc-other", StagingPath: "/staging/online", Discard: discardFstrim})).To(Succeed())
+		trimmer.err = fmt.Errorf("fstrim failed: the discard operation is not supported")
+		underTest.trimVolumes()
+		Expect(trimmer.paths).To(ConsistOf("/staging/trimmed", "/staging/online"))
+		Expect(metrics()).To(ContainSubstring(`kubevirt_csi_fstrim_failures_total{volume_id="pvc-other"} 1`))
+		Expect(metrics()).To(ContainSubstring(`kubevirt_csi_fstrim_runs_total{volume_id="pvc-trimmed"} 1`))
+		Expect(metrics()).To(ContainSubstring("kubevirt_csi_fstrim_reclaimed_bytes_total 0\n"))
+	})
+
+	It("should count the bytes it reclaimed per volume and for the node", func() {
+		Expect(store.Save(VolumeState{VolumeID: "pvc-other", StagingPath: "/staging/online", Discard: discardFstrim})).To(Succeed())
+		underTest.trimVolumes()
+		underTest.trimVolumes()
+		Expect(metrics()).To(ContainSubstring("kubevirt_csi_fstrim_reclaimed_bytes_total 16384\n"))
+		Expect(metrics()).To(ContainSubstring(`kubevirt_csi_fstrim_volume_reclaimed_bytes_total{volume_id="pvc-trimmed"} 8192`))
+		Expect(metrics()).To(ContainSubstring(`kubevirt_csi_fstrim_volume_reclaimed_bytes_total{volume_id="pvc-other"} 8192`))
+		Expect(metrics()).To(ContainSubstring(`kubevirt_csi_fstrim_runs_total{volume_id="pvc-trimmed"} 2`))
+		Expect(metrics()).ToNot(ContainSubstring(`kubevirt_csi_fstrim_failures_total{`))
+	})
+
+	It("should keep trimming when a volume state file is corrupt", func() {
+		Expect(os.WriteFile(filepath.Join(store.dir, "pvc-corrupt.json"), []byte("{"), 0600)).To(Succeed())
+		underTest.trimVolumes()
+		Expect(trimmer.paths).To(Equal([]string{"/staging/trimmed"}))
+	})
+
+	It("should parse the output of fstrim", func() {
+		trimmed, err := parseFstrimOutput("/var/lib/kubelet/plugins/globalmount: 1 GiB (1073741824 bytes) trimmed\n")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trimmed).To(Equal(int64(1073741824)))
+
+		_, err = parseFstrimOutput("fstrim: /mnt: the discard operation is not supported")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+type fakeTrimmer struct {
+	trimmed int64
+	err     error
+	paths   []string
+}
+
+func (t *fakeTrimmer) Trim(path string) (int64, error) {
+	t.paths = append(t.paths, path)
+	return t.trimmed, t.err
+}
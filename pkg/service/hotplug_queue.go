@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	klog "k8s.io/klog/v2"
+)
+
+type hotplugOperationKind string
+
+const (
+	hotplugAdd    hotplugOperationKind = "add"
+	hotplugRemove hotplugOperationKind = "remove"
+)
+
+// hotplugQueue serialises the hotplug operations of each VM. KubeVirt answers concurrent addvolume/removevolume
+// calls on the same VM with conflicts, so the operations of a VM run one after the other. All operations pending
+// while another one runs are executed as the next batch, and a request for a volume that already has the same
+// operation pending joins it instead of queueing another call. A joined operation runs until all of its callers gave
+// up, not only the one that queued it. The zero value is ready to use.
+type hotplugQueue struct {
+	mu  sync.Mutex
+	vms map[string]*vmHotplugOperations
+}
+
+type vmHotplugOperations struct {
+	pending []*hotplugOperation
+}
+
+type hotplugOperation struct {
+	kind    hotplugOperationKind
+	volume  string
+	fn      func(ctx context.Context) error
+	waiters []hotplugWaiter
+}
+
+type hotplugWaiter struct {
+	ctx  context.Context
+	done chan error
+}
+
+// do runs fn once all operations queued before it for vmKey are done, and returns its result. If an operation of the
+// same kind for volume is still pending, the caller waits for that one instead.
+func (q *hotplugQueue) do(ctx context.Context, vmKey string, kind hotplugOperationKind, volume string, fn func(ctx context.Context) error) error {
+	waiter := hotplugWaiter{ctx: ctx, done: make(chan error, 1)}
+
+	q.mu.Lock()
+	if q.vms == nil {
+		q.vms = map[string]*vmHotplugOperations{}
+	}
+	ops, running := q.vms[vmKey]
+	if !running {
+		ops = &vmHotplugOperations{}
+		q.vms[vmKey] = ops
+	}
+	if op := ops.find(kind, volume); op != nil {
+		klog.V(5).Infof("Coalescing %s of volume %s on VM %s with a pending request", kind, volume, vmKey)
+		op.waiters = append(op.waiters, waiter)
+	} else {
+		ops.pending = append(ops.pending, &hotplugOperation{
+			kind:    kind,
+			volume:  volume,
+			fn:      fn,
+			waiters: []hotplugWaiter{waiter},
+		})
+	}
+	if !running {
+		go q.work(vmKey, ops)
+	}
+	q.mu.Unlock()
+
+	select {
+	case err := <-waiter.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// work executes the pending operations of one VM in batches until there are none left.
+func (q *hotplugQueue) work(vmKey string, ops *vmHotplugOperations) {
+	for {
+		q.mu.Lock()
+		batch := ops.pending
+		ops.pending = nil
+		if len(batch) == 0 {
+			delete(q.vms, vmKey)
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+
+		klog.V(5).Infof("Running %d hotplug operations on VM %s", len(batch), vmKey)
+		for _, op := range batch {
+			err := op.run()
+			for _, waiter := range op.waiters {
+				waiter.done <- err
+			}
+		}
+	}
+}
+
+// run calls fn with a context that is cancelled once all waiters gave up. Nobody can join the operation anymore once
+// it runs, so its waiters don't change.
+func (o *hotplugOperation) run() error {
+	// Don't bother KubeVirt if all callers gave up already.
+	if err := o.waitersGaveUp(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(o.waiters[0].ctx))
+	defer cancel()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for _, waiter := range o.waiters {
+			select {
+			case <-waiter.ctx.Done():
+			case <-stop:
+				return
+			}
+		}
+		cancel()
+	}()
+	return o.fn(ctx)
+}
+
+// waitersGaveUp returns the error of the first waiter's context if the contexts of all waiters are done.
+func (o *hotplugOperation) waitersGaveUp() error {
+	for _, waiter := range o.waiters {
+		if waiter.ctx.Err() == nil {
+			return nil
+		}
+	}
+	return o.waiters[0].ctx.Err()
+}
+
+func (o *vmHotplugOperations) find(kind hotplugOperationKind, volume string) *hotplugOperation {
+	for _, op := range o.pending {
+		if op.kind == kind && op.volume == volume {
+			return op
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("hotplugQueue", func() {
+	var queue *hotplugQueue
+
+	BeforeEach(func() {
+		queue = &hotplugQueue{}
+	})
+
+	It("should run the operations of one VM one at a time", func() {
+		var running, maxRunning atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				err := queue.do(context.TODO(), "ns/vm", hotplugAdd, fmt.Sprintf("pvc-%d", i), func(context.Context) error {
+					current := running.Add(1)
+					for {
+						max := maxRunning.Load()
+						if current <= max || maxRunning.CompareAndSwap(max, current) {
+							break
+						}
+					}
+					time.Sleep(time.Millisecond)
+					running.Add(-1)
+					return nil
+				})
+				Expect(err).ToNot(HaveOccurred())
+			}(i)
+		}
+		wg.Wait()
+		Expect(maxRunning.Load()).To(Equal(int32(1)))
+	})
+
+	It("should not block the operations of other VMs", func() {
+		release := make(chan struct{})
+		blocked := make(chan error, 1)
+		go func() {
+			blocked <- queue.do(context.TODO(), "ns/vm-a", hotplugAdd, "pvc-a", func(context.Context) error {
+				<-release
+				return nil
+			})
+		}()
+
+		err := queue.do(context.TODO(), "ns/vm-b", hotplugAdd, "pvc-b", func(context.Context) error {
+			return nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(blocked).ToNot(Receive())
+		close(release)
+		Eventually(blocked).Should(Receive(BeNil()))
+	})
+
+	It("should coalesce pending requests for the same volume", func() {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		first := make(chan error, 1)
+		go func() {
+			first <- queue.do(context.TODO(), "ns/vm", hotplugAdd, "pvc-a", func(context.Context) error {
+				close(started)
+				<-release
+				return nil
+			})
+		}()
+		<-started
+
+		var calls atomic.Int32
+		results := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				results <- queue.do(context.TODO(), "ns/vm", hotplugAdd, "pvc-b", func(context.Context) error {
+					calls.Add(1)
+					return fmt.Errorf("conflict")
+				})
+			}()
+		}
+		Eventually(func() int {
+			queue.mu.Lock()
+			defer queue.mu.Unlock()
+			ops := queue.vms["ns/vm"]
+			if ops == nil || len(ops.pending) == 0 {
+				return 0
+			}
+			return len(ops.pending[0].waiters)
+		}).Should(Equal(2))
+
+		close(release)
+		Eventually(first).Should(Receive(BeNil()))
+		Eventually(results).Should(Receive(MatchError("conflict")))
+		Eventually(results).Should(Receive(MatchError("conflict")))
+		Expect(calls.Load()).To(Equal(int32(1)))
+	})
+
+	It("should keep running a coalesced request when the caller that queued it gives up", func() {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		go func() {
+			_ = queue.do(context.TODO(), "ns/vm", hotplugAdd, "pvc-a", func(context.Context) error {
+				close(started)
+				<-release
+				return nil
+			})
+		}()
+		<-started
+
+		firstCtx, cancelFirst := context.WithCancel(context.Background())
+		first := make(chan error, 1)
+		go func() {
+			first <- queue.do(firstCtx, "ns/vm", hotplugAdd, "pvc-b", func(ctx context.Context) error {
+				return ctx.Err()
+			})
+		}()
+		Eventually(func() int {
+			queue.mu.Lock()
+			defer queue.mu.Unlock()
+			ops := queue.vms["ns/vm"]
+			if ops == nil || len(ops.pending) == 0 {
+				return 0
+			}
+			return len(ops.pending[0].waiters)
+		}).Should(Equal(1))
+
+		second := make(chan error, 1)
+		go func() {
+			second <- queue.do(context.TODO(), "ns/vm", hotplugAdd, "pvc-b", func(context.Context) error {
+				return fmt.Errorf("not coalesced")
+			})
+		}()
+		Eventually(func() int {
+			queue.mu.Lock()
+			defer queue.mu.Unlock()
+			return len(queue.vms["ns/vm"].pending[0].waiters)
+		}).Should(Equal(2))
+
+		cancelFirst()
+		Eventually(first).Should(Receive(MatchError(context.Canceled)))
+		close(release)
+		Eventually(second).Should(Receive(BeNil()))
+	})
+
+	It("should cancel a running request once all of its callers gave up", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error, 1)
+		go func() {
+			result <- queue.do(ctx, "ns/vm", hotplugRemove, "pvc-a", func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			})
+		}()
+		cancel()
+		Eventually(result).Should(Receive(MatchError(context.Canceled)))
+		Eventually(func() bool {
+			queue.mu.Lock()
+			defer queue.mu.Unlock()
+			return queue.vms["ns/vm"] == nil
+		}).Should(BeTrue())
+	})
+
+	It("should give up waiting when the context is done", func() {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+		go func() {
+			_ = queue.do(context.TODO(), "ns/vm", hotplugRemove, "pvc-a", func(context.Context) error {
+				close(started)
+				<-release
+				return nil
+			})
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		called := false
+		err := queue.do(ctx, "ns/vm", hotplugRemove, "pvc-b", func(context.Context) error {
+			called = true
+			return nil
+		})
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(called).To(BeFalse())
+	})
+})
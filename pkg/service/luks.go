@@ -0,0 +1,140 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// encryptionPassphraseKey is the key in the node-stage (and node-expand) secret holding the LUKS passphrase.
+	encryptionPassphraseKey = "encryptionPassphrase"
+	luksFsType              = "crypto_LUKS"
+	luksMapperPrefix        = "luks-"
+	devMapperDir            = "/dev/mapper/"
+)
+
+// Encryptor manages the dm-crypt LUKS mappings of encrypted volumes.
+type Encryptor interface {
+	Format(devicePath, passphrase string) error
+	Open(devicePath, mapperName, passphrase string) error
+	Close(mapperName string) error
+	Resize(mapperName, passphrase string) error
+	IsOpen(mapperName string) (bool, error)
+}
+
+var NewEncryptor = func() Encryptor {
+	return &cryptsetup{}
+}
+
+// cryptsetup implements Encryptor by shelling out to cryptsetup. Passphrases are always passed on stdin.
+type cryptsetup struct{}
+
+func (c *cryptsetup) Format(devicePath, passphrase string) error {
+	return runCryptsetup(passphrase, "luksFormat", "--type", "luks2", "--batch-mode", "--key-file", "-", devicePath)
+}
+
+func (c *cryptsetup) Open(devicePath, mapperName, passphrase string) error {
+	return runCryptsetup(passphrase, "open", "--type", "luks", "--key-file", "-", devicePath, mapperName)
+}
+
+func (c *cryptsetup) Close(mapperName string) error {
+	return runCryptsetup("", "close", mapperName)
+}
+
+func (c *cryptsetup) Resize(mapperName, passphrase string) error {
+	if passphrase == "" {
+		return runCryptsetup("", "resize", mapperName)
+	}
+	return runCryptsetup(passphrase, "resize", "--key-file", "-", mapperName)
+}
+
+func (c *cryptsetup) IsOpen(mapperName string) (bool, error) {
+	_, err := os.Stat(devMapperDir + mapperName)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+func runCryptsetup(passphrase string, args ...string) error {
+	klog.V(5).Infof("cryptsetup %s", strings.Join(args, " "))
+	var stderr bytes.Buffer
+	cmd := exec.Command("cryptsetup", args...)
+	cmd.Stdin = strings.NewReader(passphrase)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			return errors.New(err.Error() + " cryptsetup failed with " + stderr.String())
+		}
+		return err
+	}
+	return nil
+}
+
+func isEncrypted(volumeContext map[string]string) bool {
+	return volumeContext[encryptedParameter] == "true"
+}
+
+func luksMapperName(volumeID string) string {
+	return luksMapperPrefix + volumeName(volumeID)
+}
+
+// openEncryptedDevice formats the device with LUKS if it is blank, opens the dm-crypt mapping and returns the
+// mapped device that the filesystem lives on.
+func (n *NodeService) openEncryptedDevice(volumeID, serialID string, dev device, secrets map[string]string) (device, error) {
+	passphrase := secrets[encryptionPassphraseKey]
+	if passphrase == "" {
+		return device{}, status.Errorf(codes.InvalidArgument, "encrypted volume %s requires %q in the node stage secret", volumeID, encryptionPassphraseKey)
+	}
+
+	switch dev.Fstype {
+	case "":
+		klog.V(3).Infof("Formatting device %s of volume %s with LUKS", dev.Path, volumeID)
+		if err := n.encryptor.Format(dev.Path, passphrase); err != nil {
+			return device{}, status.Errorf(codes.Internal, "failed to format %s with LUKS: %v", dev.Path, err)
+		}
+	case luksFsType:
+	default:
+		return device{}, status.Errorf(codes.FailedPrecondition, "device %s of encrypted volume %s already contains a %s filesystem", dev.Path, volumeID, dev.Fstype)
+	}
+
+	mapperName := luksMapperName(volumeID)
+	open, err := n.encryptor.IsOpen(mapperName)
+	if err != nil {
+		return device{}, err
+	}
+	if !open {
+		klog.V(3).Infof("Opening LUKS device %s as %s", dev.Path, mapperName)
+		if err := n.encryptor.Open(dev.Path, mapperName, passphrase); err != nil {
+			return device{}, status.Errorf(codes.Internal, "failed to open LUKS device %s: %v", dev.Path, err)
+		}
+	}
+
+	return getMappedDevice(serialID, mapperName, n.deviceLister)
+}
+
+// getMappedDevice returns the dm-crypt mapping named mapperName that sits on top of the device with the given serial.
+func getMappedDevice(serialID, mapperName string, deviceLister DeviceLister) (device, error) {
+	dev, err := getDeviceBySerialID(serialID, deviceLister)
+	if err != nil {
+		return device{}, err
+	}
+	for _, child := range dev.Children {
+		if child.Name == mapperName {
+			child.Path = devMapperDir + child.Name
+			return child, nil
+		}
+	}
+	return device{}, status.Errorf(codes.FailedPrecondition, "LUKS mapping %s is not open on device %s", mapperName, dev.Path)
+}
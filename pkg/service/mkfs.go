@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	klog "k8s.io/klog/v2"
+)
+
+// mkfsOptionsParameter passes extra options of the StorageClass to mkfs when the node creates the filesystem.
+const mkfsOptionsParameter = "mkfsOptions"
+
+// filesystem describes how the node creates a filesystem: the flags it always passes to mkfs and the options users
+// may add with mkfsOptions. Options mapped to true take a value.
+type filesystem struct {
+	mkfsArgs       []string
+	allowedOptions map[string]bool
+}
+
+var extOptions = map[string]bool{
+	"-b": true, // block size
+	"-i": true, // bytes per inode
+	"-I": true, // inode size
+	"-N": true, // number of inodes
+	"-E": true, // extended options, e.g. lazy_itable_init=0
+	"-O": true, // features
+	"-T": true, // usage type
+	"-L": true, // label
+	"-j": false,
+}
+
+var filesystems = map[string]filesystem{
+	// Don't reserve root space on ext filesystems, since these volumes are mounted it makes no sense to reserve
+	// the space.
+	"ext2": {mkfsArgs: []string{"-m", "0", "-F"}, allowedOptions: extOptions},
+	"ext3": {mkfsArgs: []string{"-m", "0", "-F"}, allowedOptions: extOptions},
+	"ext4": {mkfsArgs: []string{"-m", "0", "-F"}, allowedOptions: extOptions},
+	"xfs": {mkfsArgs: []string{"-f"}, allowedOptions: map[string]bool{
+		"-b": true, // block size
+		"-d": true, // data section, e.g. su=,sw=
+		"-i": true, // inode options, e.g. size=
+		"-l": true, // log section
+		"-m": true, // metadata options, e.g. reflink=1
+		"-n": true, // naming options
+		"-L": true, // label
+		"-K": false,
+	}},
+	"btrfs": {mkfsArgs: []string{"-f"}, allowedOptions: map[string]bool{
+		"-n": true, // node size
+		"-s": true, // sector size
+		"-d": true, // data profile
+		"-m": true, // metadata profile
+		"-O": true, // features
+		"-R": true, // runtime features
+		"-L": true, // label
+		"-K": false,
+	}},
+}
+
+// mkfsOptionValue restricts option values, so they can't smuggle in further options or paths.
+var mkfsOptionValue = regexp.MustCompile(`^[A-Za-z0-9_.,=:+^][A-Za-z0-9_.,=:+^-]*$`)
+
+// parseMkfsOptions validates the mkfsOptions of a volume with the given filesystem and splits them into arguments.
+func parseMkfsOptions(fsType, options string) ([]string, error) {
+	fs, ok := filesystems[fsType]
+	if !ok {
+		return nil, fmt.Errorf("filesystem %q is not supported, supported filesystems are %s", fsType, strings.Join(supportedFilesystems(), ", "))
+	}
+	args := strings.Fields(options)
+	for i := 0; i < len(args); i++ {
+		takesValue, allowed := fs.allowedOptions[args[i]]
+		if !allowed {
+			return nil, fmt.Errorf("mkfs option %q is not allowed for %s", args[i], fsType)
+		}
+		if !takesValue {
+			continue
+		}
+		i++
+		if i == len(args) || !mkfsOptionValue.MatchString(args[i]) {
+			return nil, fmt.Errorf("mkfs option %s of %s requires a valid value", args[i-1], fsType)
+		}
+	}
+	return args, nil
+}
+
+// validateMkfsOptions checks the mkfsOptions of a new volume against the filesystem of every capability it is
+// requested with.
+func validateMkfsOptions(capabilities []*csi.VolumeCapability, options string) error {
+	if options == "" {
+		return nil
+	}
+	for _, capability := range capabilities {
+		fsType := capability.GetMount().GetFsType()
+		if fsType == "" {
+			continue
+		}
+		if _, err := parseMkfsOptions(fsType, options); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid %s: %v", mkfsOptionsParameter, err)
+		}
+	}
+	return nil
+}
+
+func supportedFilesystems() []string {
+	var names []string
+	for name := range filesystems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func makeFS(device string, fsType string, options []string) error {
+	// caution, use force flag when creating the filesystem if it doesn't exit.
+	klog.Infof("Mounting device %s, with FS %s", device, fsType)
+
+	fs, ok := filesystems[fsType]
+	if !ok {
+		return errors.New(fsType + " is not supported, only " + strings.Join(supportedFilesystems(), ", ") + " are supported")
+	}
+	args := slices.Concat([]string{"-t", fsType}, fs.mkfsArgs, options, []string{device})
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("mkfs", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			klog.Errorf("stdout: %s", stdout.String())
+			klog.Errorf("stderr: %s", stderr.String())
+			return errors.New(err.Error() + " mkfs failed with " + exitError.Error())
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// forbiddenMountFlags would change what is mounted where, or let the volume weaken the security of the node.
+var forbiddenMountFlags = []string{
+	"bind", "rbind", "remount", "move", "loop",
+	"suid", "dev", "user", "users", "owner", "group",
+	"shared", "rshared", "slave", "rslave", "private", "rprivate", "unbindable", "runbindable",
+}
+
+// conflictingMountFlags are pairs of mount flags that contradict each other.
+var conflictingMountFlags = [][2]string{
+	{"ro", "rw"},
+	{"exec", "noexec"},
+	{"sync", "async"},
+	{"atime", "noatime"},
+	{"diratime", "nodiratime"},
+	{"relatime", "norelatime"},
+	{"strictatime", "nostrictatime"},
+}
+
+// unlistedMountFlags are flags the kernel doesn't list among the options of a mount, because they are the defaults or
+// only mean something to the mount command, mapped to the flag that it lists when they are not in effect.
+var unlistedMountFlags = map[string]string{
+	"defaults":      "",
+	"async":         "sync",
+	"exec":          "noexec",
+	"atime":         "noatime",
+	"diratime":      "nodiratime",
+	"norelatime":    "relatime",
+	"nostrictatime": "strictatime",
+	"auto":          "",
+	"noauto":        "",
+	"nofail":        "",
+	"nouser":        "",
+	"_netdev":       "",
+}
+
+// mountFlags returns the mount flags of the volume capability, which come from the mountOptions of the StorageClass
+// or the PV. It returns InvalidArgument if they contain flags that are not allowed or contradict each other.
+func mountFlags(capability *csi.VolumeCapability) ([]string, error) {
+	flags := capability.GetMount().GetMountFlags()
+	for _, flag := range flags {
+		name, _, _ := strings.Cut(flag, "=")
+		name = strings.ToLower(name)
+		if slices.Contains(forbiddenMountFlags, name) || strings.HasPrefix(name, "make-") || strings.HasPrefix(name, "x-") {
+			return nil, status.Errorf(codes.InvalidArgument, "mount flag %q is not allowed", flag)
+		}
+	}
+	for _, pair := range conflictingMountFlags {
+		if slices.Contains(flags, pair[0]) && slices.Contains(flags, pair[1]) {
+			return nil, status.Errorf(codes.InvalidArgument, "mount flags %q and %q conflict", pair[0], pair[1])
+		}
+	}
+	return flags, nil
+}
+
+// mergeMountOptions appends the requested mount flags to the options of the driver, leaving out duplicates.
+func mergeMountOptions(options, flags []string) []string {
+	merged := slices.Clone(options)
+	for _, flag := range flags {
+		if !slices.Contains(merged, flag) {
+			merged = append(merged, flag)
+		}
+	}
+	return merged
+}
+
+// mountOptionsDiffer tells whether path is mounted without some of the options, so it has to be remounted with them.
+// Only the requested options are compared, the kernel lists the options of a mount together with the defaults of
+// the filesystem, like relatime, seclabel or inode64, and leaves out the flags that are in effect by default.
+func (n *NodeService) mountOptionsDiffer(path string, options []string) (bool, error) {
+	mountPoint, err := n.mountPoint(path)
+	if err != nil {
+		return false, err
+	}
+	current := mountPoint.Opts
+	for _, option := range options {
+		if opposite, unlisted := unlistedMountFlags[option]; unlisted {
+			if opposite != "" && slices.Contains(current, opposite) {
+				return true, nil
+			}
+		} else if !slices.Contains(current, option) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
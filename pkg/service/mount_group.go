@@ -0,0 +1,85 @@
+package service
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// mountGroupFileMode and mountGroupDirMode are the permissions the group of the pods gets, the same kubelet grants
+	// when it applies the fsGroup itself. Directories are setgid so new files inherit the group.
+	mountGroupFileMode = 0660
+	mountGroupDirMode  = 0770 | fs.ModeSetgid
+)
+
+// volumeMountGroup returns the group ID kubelet delegates to the driver with the VOLUME_MOUNT_GROUP capability, the
+// fsGroup of the pod, or -1 when there is none.
+func volumeMountGroup(capability *csi.VolumeCapability) (int, error) {
+	group := capability.GetMount().GetVolumeMountGroup()
+	if group == "" {
+		return -1, nil
+	}
+	gid, err := strconv.Atoi(group)
+	if err != nil || gid < 0 {
+		return -1, status.Errorf(codes.InvalidArgument, "volume mount group %q is not a group ID", group)
+	}
+	return gid, nil
+}
+
+// setVolumeMountGroup gives the group gid access to the filesystem mounted at root, like kubelet does for the fsGroup
+// of a pod. ext, xfs and btrfs have no mount option that sets the group of their files, so the files are chowned. Like
+// the OnRootMismatch fsGroupChangePolicy, the filesystem is only walked when its root doesn't have the group and
+// permissions yet, so large volumes are walked once instead of on every mount.
+func setVolumeMountGroup(root string, gid int) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to stat %s: %v", root, err)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Gid) == gid && info.Mode()&mountGroupDirMode == mountGroupDirMode {
+		return nil
+	}
+
+	klog.V(3).Infof("Changing the group of the files in %s to %d", root, gid)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := os.Lchown(path, -1, gid); err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := info.Mode() | mountGroupFileMode
+		if d.IsDir() {
+			mode |= mountGroupDirMode
+		}
+		return os.Chmod(path, mode)
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to change the group of %s to %d: %v", root, gid, err)
+	}
+	return nil
+}
+
+// applyVolumeMountGroup gives the volume mount group of the capability access to the filesystem mounted at path.
+// Read only volumes are left alone, their files can't be changed.
+func applyVolumeMountGroup(path string, capability *csi.VolumeCapability) error {
+	gid, err := volumeMountGroup(capability)
+	if err != nil || gid < 0 || isReadOnlyCapability(capability) {
+		return err
+	}
+	return setVolumeMountGroup(path, gid)
+}
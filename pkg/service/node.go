@@ -1,7 +1,6 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,8 +8,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"golang.org/x/sys/unix"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	mount "k8s.io/mount-utils"
@@ -28,8 +30,11 @@ var (
 		csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
 		csi.NodeServiceCapability_RPC_EXPAND_VOLUME,
 		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+		csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP,
+		csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
 	}
 	ErrMountDeviceNotFound = errors.New("could not find device path for mount")
+	errDeviceNotFound      = errors.New("couldn't find device by serial id")
 )
 
 // NodeService implements the CSI Driver node service
@@ -38,10 +43,30 @@ type NodeService struct {
 	nodeID           string
 	deviceLister     DeviceLister
 	fsMaker          FsMaker
+	fsChecker        FsChecker
+	fsUUIDChanger    FsUUIDChanger
+	eventRecorder    VolumeEventRecorder
 	mounter          mounter.Mounter
 	resizer          ResizerInterface
 	devicePathGetter DevicePathGetter
 	dirMaker         dirMaker
+	encryptor        Encryptor
+	deviceRescanner  DeviceRescanner
+	// volumeConditionChecker reports the health of volumes in NodeGetVolumeStats, nil means not reporting it.
+	volumeConditionChecker VolumeConditionChecker
+	// stateStore remembers the staged volumes that are trimmed periodically, nil means not remembering them.
+	stateStore VolumeStateStore
+	trimmer    Trimmer
+	// deviceReleaser checks that unstaged devices are unused and flushes them, nil means not checking them.
+	deviceReleaser DeviceReleaser
+	// deviceSizer makes the kernel notice expanded disks, nil means not waiting for them to grow.
+	deviceSizer   DeviceSizer
+	fstrimMetrics *fstrimMetrics
+	// deviceWaitTimeout bounds waiting for a hotplugged device to show up or an expanded one to grow, zero means not
+	// waiting.
+	deviceWaitTimeout time.Duration
+	// maxVolumesPerNode is reported to the scheduler, zero means no limit.
+	maxVolumesPerNode int64
 }
 
 type DeviceLister interface {
@@ -51,7 +76,7 @@ type DevicePathGetter interface {
 	Get(mountPath string) (string, error)
 }
 type FsMaker interface {
-	Make(device string, fsType string) error
+	Make(device string, fsType string, options []string) error
 }
 type dirMaker interface {
 	Make(path string, perm os.FileMode) error
@@ -67,11 +92,7 @@ var NewResizer = func() ResizerInterface {
 }
 
 var NewDeviceLister = func() DeviceLister {
-	return deviceListerFunc(func() ([]byte, error) {
-		klog.V(5).Info("lsblk -nJo SERIAL,FSTYPE,NAME")
-		// must be lsblk recent enough for json format
-		return exec.Command("lsblk", "-nJo", "SERIAL,FSTYPE,NAME").Output()
-	})
+	return &sysfsDeviceLister{sysBlockDir: sysBlockDir, devDir: devDir}
 }
 
 var NewDevicePathGetter = func() DevicePathGetter {
@@ -98,19 +119,32 @@ var NewNodeMounter = func() mounter.Mounter {
 }
 
 var NewFsMaker = func() FsMaker {
-	return fsMakerFunc(func(device, fsType string) error {
-		return makeFS(device, fsType)
+	return fsMakerFunc(func(device, fsType string, options []string) error {
+		return makeFS(device, fsType, options)
 	})
 }
 
-func NewNodeService(nodeId string) *NodeService {
+func NewNodeService(nodeId string, maxVolumesPerNode int64, eventRecorder VolumeEventRecorder) *NodeService {
 	return &NodeService{
-		nodeID:           nodeId,
-		deviceLister:     NewDeviceLister(),
-		devicePathGetter: NewDevicePathGetter(),
-		fsMaker:          NewFsMaker(),
-		mounter:          NewNodeMounter(),
-		resizer:          NewResizer(),
+		nodeID:                 nodeId,
+		maxVolumesPerNode:      nodeMaxHotplugVolumes(maxVolumesPerNode),
+		deviceLister:           NewDeviceLister(),
+		devicePathGetter:       NewDevicePathGetter(),
+		fsMaker:                NewFsMaker(),
+		fsChecker:              NewFsChecker(),
+		fsUUIDChanger:          NewFsUUIDChanger(),
+		eventRecorder:          eventRecorder,
+		mounter:                NewNodeMounter(),
+		resizer:                NewResizer(),
+		encryptor:              NewEncryptor(),
+		deviceRescanner:        NewDeviceRescanner(),
+		volumeConditionChecker: NewVolumeConditionChecker(),
+		stateStore:             NewVolumeStateStore(),
+		trimmer:                NewTrimmer(),
+		fstrimMetrics:          &fstrimMetrics{},
+		deviceReleaser:         NewDeviceReleaser(),
+		deviceSizer:            NewDeviceSizer(),
+		deviceWaitTimeout:      DefaultDeviceWaitTimeout,
 		dirMaker: dirMakerFunc(func(path string, perm os.FileMode) error {
 			// MkdirAll returns nil if path already exists
 			return os.MkdirAll(path, perm)
@@ -130,10 +164,10 @@ func (d devicePathGetterFunc) Get(mountPath string) (string, error) {
 	return d(mountPath)
 }
 
-type fsMakerFunc func(device, fsType string) error
+type fsMakerFunc func(device, fsType string, options []string) error
 
-func (f fsMakerFunc) Make(device, fsType string) error {
-	return f(device, fsType)
+func (f fsMakerFunc) Make(device, fsType string, options []string) error {
+	return f(device, fsType, options)
 }
 
 type dirMakerFunc func(path string, perm os.FileMode) error
@@ -159,44 +193,148 @@ func (n *NodeService) validateNodeStageVolumeRequest(req *csi.NodeStageVolumeReq
 	return nil
 }
 
-// NodeStageVolume prepares the volume for usage. If it's an FS type it creates a file system on the volume.
-func (n *NodeService) NodeStageVolume(_ context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+// NodeStageVolume prepares the volume for usage. If it's an FS type it creates a file system on the volume and mounts
+// it at the staging path, which NodePublishVolume bind-mounts into the pods, so they share a single mount of the device.
+func (n *NodeService) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
 	if err := n.validateNodeStageVolumeRequest(req); err != nil {
 		return nil, err
 	}
 	klog.V(3).Infof("Staging volume %s", req.VolumeId)
 
-	if req.VolumeCapability.GetMount() == nil {
+	encrypted := isEncrypted(req.VolumeContext)
+	if req.VolumeCapability.GetMount() == nil && !encrypted {
+		if err := n.saveVolumeState(req, discardNone); err != nil {
+			return nil, err
+		}
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
+	flags, err := mountFlags(req.VolumeCapability)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := fsckPolicy(req.VolumeContext)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := volumeMountGroup(req.VolumeCapability); err != nil {
+		return nil, err
+	}
+	discard, err := discardMode(req.VolumeContext)
+	if err != nil {
+		return nil, err
+	}
+	flags = discardMountFlags(flags, discard)
 
 	// Filesystem volume mode, create FS if needed
 	// get the VMI volumes which are under VMI.spec.volumes
 	// serialID = kubevirt's DataVolume.UID
-	device, err := getDeviceBySerialID(req.VolumeContext[serialParameter], n.deviceLister)
+	serialID := req.VolumeContext[serialParameter]
+	device, err := n.waitForDevice(ctx, serialID, req.VolumeContext[busParameter])
 	if err != nil {
 		klog.Errorf("Failed to fetch device by serialID %s", req.VolumeId)
 		return nil, err
 	}
 
+	if encrypted {
+		// The filesystem (or the raw block volume) lives on the dm-crypt mapping, not on the device itself.
+		device, err = n.openEncryptedDevice(req.VolumeId, serialID, device, req.GetSecrets())
+		if err != nil {
+			klog.Errorf("Failed to open encrypted volume %s: %v", req.VolumeId, err)
+			return nil, err
+		}
+		if req.VolumeCapability.GetMount() == nil {
+			if err := n.saveVolumeState(req, discardNone); err != nil {
+				return nil, err
+			}
+			return &csi.NodeStageVolumeResponse{}, nil
+		}
+	}
+
+	fsType := req.VolumeCapability.GetMount().FsType
+	ownUUID := false
 	// is there a filesystem on this device?
+	if isDataSignature(device.Fstype) || isForeignFilesystem(device.Fstype, fsType) {
+		return nil, status.Errorf(codes.FailedPrecondition, "device %s of volume %s holds %s data, refusing to format or mount it", device.Path, req.VolumeId, device.Fstype)
+	}
 	if device.Fstype != "" {
 		klog.V(3).Infof("Detected fs %s", device.Fstype)
-		return &csi.NodeStageVolumeResponse{}, nil
+		if err := n.checkFilesystem(req.VolumeId, device, policy); err != nil {
+			return nil, err
+		}
+		if ownUUID, err = n.regenerateFilesystemUUID(req, device); err != nil {
+			return nil, err
+		}
+	} else {
+		// no filesystem - create it
+		options, err := parseMkfsOptions(fsType, req.VolumeContext[mkfsOptionsParameter])
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		klog.V(3).Infof("Creating FS %s on device %s", fsType, device)
+		err = n.fsMaker.Make(device.Path, fsType, options)
+		if err != nil {
+			klog.Errorf("Could not create filesystem %s on %s", fsType, device)
+			return nil, err
+		}
 	}
 
-	fsType := req.VolumeCapability.GetMount().FsType
-	// no filesystem - create it
-	klog.V(3).Infof("Creating FS %s on device %s", fsType, device)
-	err = n.fsMaker.Make(device.Path, fsType)
-	if err != nil {
-		klog.Errorf("Could not create filesystem %s on %s", fsType, device)
+	if err := n.mountStagingPath(device, req.GetStagingTargetPath(), fsType, flags, ownUUID); err != nil {
+		return nil, err
+	}
+	if err := applyVolumeMountGroup(req.GetStagingTargetPath(), req.VolumeCapability); err != nil {
+		return nil, err
+	}
+	if err := n.saveVolumeState(req, discard); err != nil {
 		return nil, err
 	}
-
 	return &csi.NodeStageVolumeResponse{}, nil
 }
 
+// mountStagingPath mounts the filesystem of the device at the staging path unless it is mounted there already, in which
+// case it is remounted if it lacks some of the mount flags. It grows the filesystem if the volume was expanded while it
+// wasn't staged. xfs filesystems that may share their UUID with the volume they were copied from, because ownUUID is
+// false, are mounted with nouuid.
+func (n *NodeService) mountStagingPath(device device, stagingPath, fsType string, flags []string, ownUUID bool) error {
+	notMnt, err := n.mounter.IsLikelyNotMountPoint(stagingPath)
+	if err != nil && !os.IsNotExist(err) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if device.Fstype != "" {
+		fsType = device.Fstype
+	}
+	mountOptions := []string{}
+	if fsType == "xfs" && !ownUUID {
+		// Add nouuid to fix duplicate XFS uuid when restoring from snapshot.
+		mountOptions = append(mountOptions, "nouuid")
+	}
+	mountOptions = mergeMountOptions(mountOptions, flags)
+	if notMnt {
+		// MkdirAll returns nil if path already exists
+		if err := n.dirMaker.Make(stagingPath, 0750); err != nil {
+			return err
+		}
+		klog.V(3).Infof("Mounting devicePath %s, on stagingPath: %s with FS type: %s", device.Path, stagingPath, fsType)
+		if err := n.mounter.Mount(device.Path, stagingPath, fsType, mountOptions); err != nil {
+			klog.Errorf("failed mounting %v", err)
+			return err
+		}
+	} else if differ, err := n.mountOptionsDiffer(stagingPath, mountOptions); err != nil {
+		return err
+	} else if differ {
+		klog.V(3).Infof("Remounting stagingPath: %s with options %v", stagingPath, mountOptions)
+		if err := n.mounter.Mount(device.Path, stagingPath, fsType, append([]string{"remount"}, mountOptions...)); err != nil {
+			klog.Errorf("failed remounting %v", err)
+			return err
+		}
+	}
+
+	if fsType == "ext2" {
+		// ext2 can't be grown while it is mounted.
+		return nil
+	}
+	return n.resizeFs(device.Path, stagingPath)
+}
+
 func (n *NodeService) validateNodeUnstageVolumeRequest(req *csi.NodeUnstageVolumeRequest) error {
 	if req == nil {
 		return status.Error(codes.InvalidArgument, "missing request")
@@ -218,10 +356,152 @@ func (n *NodeService) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstag
 		return nil, err
 	}
 	klog.V(3).Info("Validate Node unstage completed")
-	// nothing to do here, we don't erase the filesystem of a device.
+	stagingPath := req.GetStagingTargetPath()
+	notMnt, err := n.mounter.IsLikelyNotMountPoint(stagingPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	stagingSource := ""
+	if !notMnt {
+		stagingSource, err = n.mountSource(stagingPath)
+		if err != nil {
+			return nil, err
+		}
+		klog.V(5).Infof("Unmounting %s", stagingPath)
+		if err := n.mounter.Unmount(stagingPath); err != nil {
+			klog.Errorf("failed to unmount %v", err)
+			return nil, err
+		}
+	}
+
+	// we don't erase the filesystem of a device, only close the LUKS mapping of encrypted volumes.
+	mapperName := luksMapperName(req.GetVolumeId())
+	open, err := n.encryptor.IsOpen(mapperName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to check LUKS mapping %s: %v", mapperName, err)
+	}
+	if open {
+		// Closing a mapping that is still in use fails, find out who uses it first, like for the disk below.
+		if err := n.checkDeviceUnused(req.GetVolumeId(), devMapperDir+mapperName); err != nil {
+			return nil, err
+		}
+		klog.V(3).Infof("Closing LUKS mapping %s", mapperName)
+		if err := n.encryptor.Close(mapperName); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to close LUKS mapping %s: %v", mapperName, err)
+		}
+	}
+
+	if err := n.releaseDevice(req.GetVolumeId(), stagingSource); err != nil {
+		return nil, err
+	}
+	if n.stateStore != nil {
+		if err := n.stateStore.Delete(req.GetVolumeId()); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to delete the state of volume %s: %v", req.GetVolumeId(), err)
+		}
+	}
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
 
+// releaseDevice is the handshake that makes detaching the volume safe: it returns FailedPrecondition while the device
+// of the volume is still mounted or held by other devices, so kubelet retries NodeUnstageVolume and the controller
+// doesn't unplug a busy disk, and flushes the buffers of the device otherwise.
+func (n *NodeService) releaseDevice(volumeID, stagingSource string) error {
+	if n.deviceReleaser == nil {
+		return nil
+	}
+	devicePath, err := n.stagedDevicePath(volumeID, stagingSource)
+	if err != nil || devicePath == "" {
+		return err
+	}
+	if err := n.checkDeviceUnused(volumeID, devicePath); err != nil {
+		return err
+	}
+
+	klog.V(3).Infof("Flushing the buffers of device %s of volume %s", devicePath, volumeID)
+	if err := n.deviceReleaser.Flush(devicePath); err != nil {
+		return status.Errorf(codes.Internal, "failed to flush device %s of volume %s: %v", devicePath, volumeID, err)
+	}
+	return nil
+}
+
+// checkDeviceUnused returns FailedPrecondition while the device is still mounted or held by other devices.
+func (n *NodeService) checkDeviceUnused(volumeID, devicePath string) error {
+	if n.deviceReleaser == nil {
+		return nil
+	}
+	mountPoints, err := n.mounter.List()
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to list mounts: %v", err)
+	}
+	var mountPaths []string
+	for _, mountPoint := range mountPoints {
+		if mountPoint.Device == devicePath {
+			mountPaths = append(mountPaths, mountPoint.Path)
+		}
+	}
+	if len(mountPaths) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "device %s of volume %s is still mounted at %s", devicePath, volumeID, strings.Join(mountPaths, ", "))
+	}
+	holders, err := n.deviceReleaser.Holders(devicePath)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to find the holders of device %s: %v", devicePath, err)
+	}
+	if len(holders) > 0 {
+		return status.Errorf(codes.FailedPrecondition, "device %s of volume %s is still held by %s", devicePath, volumeID, strings.Join(holders, ", "))
+	}
+	return nil
+}
+
+// stagedDevicePath returns the device of a staged volume, found by the serial saved when it was staged or else the
+// source it is mounted from. It returns an empty path when the device is gone already.
+func (n *NodeService) stagedDevicePath(volumeID, source string) (string, error) {
+	if n.stateStore != nil {
+		state, found, err := n.stateStore.Get(volumeID)
+		if err != nil {
+			return "", status.Errorf(codes.Internal, "failed to read the state of volume %s: %v", volumeID, err)
+		}
+		if found && state.Serial != "" {
+			dev, err := getDeviceBySerialID(state.Serial, n.deviceLister)
+			if errors.Is(err, errDeviceNotFound) {
+				return "", nil
+			} else if err != nil {
+				return "", status.Errorf(codes.Internal, "failed to find the device of volume %s: %v", volumeID, err)
+			}
+			return dev.Path, nil
+		}
+	}
+	if source == "" {
+		return "", nil
+	}
+	// The source of an encrypted volume is its LUKS mapping, which is closed by now.
+	if _, err := os.Stat(source); err != nil {
+		return "", nil
+	}
+	return source, nil
+}
+
+// mountSource returns the device mounted at path.
+func (n *NodeService) mountSource(path string) (string, error) {
+	mountPoint, err := n.mountPoint(path)
+	return mountPoint.Device, err
+}
+
+// mountPoint returns the mount at path, or an empty one when nothing is mounted there.
+func (n *NodeService) mountPoint(path string) (mount.MountPoint, error) {
+	mountPoints, err := n.mounter.List()
+	if err != nil {
+		return mount.MountPoint{}, status.Errorf(codes.Internal, "failed to list mounts: %v", err)
+	}
+	var found mount.MountPoint
+	for _, mountPoint := range mountPoints {
+		// The last entry wins when several mounts are stacked on the path.
+		if mountPoint.Path == path {
+			found = mountPoint
+		}
+	}
+	return found, nil
+}
+
 func (n *NodeService) validateRequestCapabilties(req *csi.NodePublishVolumeRequest) error {
 	if req == nil {
 		return status.Error(codes.InvalidArgument, "missing request")
@@ -251,11 +531,15 @@ func (n *NodeService) validateNodePublishRequest(req *csi.NodePublishVolumeReque
 	if req.GetVolumeCapability().GetMount() == nil && req.GetVolumeCapability().GetBlock() == nil {
 		return status.Error(codes.InvalidArgument, "volume mode is not specified")
 	}
+	if req.GetVolumeCapability().GetMount() != nil && req.GetStagingTargetPath() == "" {
+		return status.Error(codes.InvalidArgument, "staging target path not provided")
+	}
 
 	return nil
 }
 
-// NodePublishVolume mounts the volume to the target path (req.GetTargetPath)
+// NodePublishVolume bind-mounts the staging path of filesystem volumes, or the device of block volumes, to the target
+// path (req.GetTargetPath)
 func (n *NodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
 	if req != nil {
 		klog.V(3).Infof("Node Publish Request: %s", req.String())
@@ -263,42 +547,67 @@ func (n *NodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	if err := n.validateNodePublishRequest(req); err != nil {
 		return nil, err
 	}
-	fsType := ""
-	if req.VolumeCapability.GetMount() != nil {
-		fsType = req.VolumeCapability.GetMount().FsType
+
+	flags, err := mountFlags(req.GetVolumeCapability())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := volumeMountGroup(req.GetVolumeCapability()); err != nil {
+		return nil, err
 	}
 
-	mountOptions := []string{}
 	block := req.GetVolumeCapability().GetBlock() != nil
+	source := req.GetStagingTargetPath()
 	if block {
-		mountOptions = append(mountOptions, "bind")
-	} else if fsType == "xfs" {
-		// Add nouuid to fix duplicate XFS uuid when restoring from snapshot.
-		// Alternatively we could run xfs_admin -U generate <device> to generate a new UUID
-		mountOptions = append(mountOptions, "nouuid")
+		device, err := n.publishedDevice(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		source = device.Path
+	} else {
+		if err := n.ensureStaged(ctx, req, flags); err != nil {
+			return nil, err
+		}
+		// Pods that share the volume can have different fsGroups. Like kubelet, every pod gets its group when it is
+		// published, the filesystem is only walked again when the group of its root doesn't match.
+		if err := applyVolumeMountGroup(req.GetStagingTargetPath(), req.GetVolumeCapability()); err != nil {
+			return nil, err
+		}
 	}
 
-	// volumeID = serialID = kubevirt's DataVolume.metadata.uid
-	// TODO link to kubevirt code
-	device, err := getDeviceBySerialID(req.VolumeContext[serialParameter], n.deviceLister)
-	if err != nil {
-		klog.Errorf("failed to fetch device by serialID %s ", req.VolumeId)
-		return nil, err
+	if req.GetReadonly() {
+		flags = mergeMountOptions(flags, []string{"ro"})
 	}
 
 	targetPath := req.GetTargetPath()
+	mountOptions := mergeMountOptions([]string{"bind"}, flags)
 	notMnt, err := n.mounter.IsLikelyNotMountPoint(targetPath)
 	if err != nil && !os.IsNotExist(err) {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
-	if notMnt {
-		if err := n.mountToTargetPath(req, block, targetPath, device, fsType, mountOptions); err != nil {
+	if !notMnt {
+		action, err := n.checkPublishedMount(ctx, req, block, source, flags)
+		if err != nil {
 			return nil, err
 		}
+		switch action {
+		case remountTarget:
+			klog.V(3).Infof("Remounting targetPath: %s with options %v", targetPath, flags)
+			if err := n.mounter.BindRemount(targetPath, flags); err != nil {
+				klog.Errorf("failed remounting %v", err)
+				return nil, err
+			}
+		case replaceTargetMount:
+			klog.V(3).Infof("Mounting targetPath: %s again with options %v", targetPath, mountOptions)
+			if err := n.mounter.Unmount(targetPath); err != nil {
+				klog.Errorf("failed to unmount %v", err)
+				return nil, err
+			}
+			notMnt = true
+		}
 	}
-
-	if !block {
-		if err := n.resizeFs(device.Path, targetPath); err != nil {
+	if notMnt {
+		if err := n.mountToTargetPath(req, block, targetPath, source, mountOptions); err != nil {
 			return nil, err
 		}
 	}
@@ -306,6 +615,135 @@ func (n *NodeService) NodePublishVolume(ctx context.Context, req *csi.NodePublis
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
+// targetMountAction is what NodePublishVolume does with a target path that is mounted already.
+type targetMountAction int
+
+const (
+	keepTargetMount targetMountAction = iota
+	// remountTarget changes the flags of the bind mount in place.
+	remountTarget
+	// replaceTargetMount unmounts the target path and mounts it again.
+	replaceTargetMount
+)
+
+// checkPublishedMount tells what to do with the target path, which is mounted already. The mount may be left over
+// from before a restart of the node plugin, or the disk of the volume may have shown up as another device since, so a
+// mount of another device than the one found by the serial of the volume is replaced, while a mount that lacks some
+// of the mount flags is remounted with them. It returns AlreadyExists when the target path is mounted with another
+// read only mode, and FailedPrecondition when the staging path holds another device than the disk of the volume.
+func (n *NodeService) checkPublishedMount(ctx context.Context, req *csi.NodePublishVolumeRequest, block bool, source string, flags []string) (targetMountAction, error) {
+	targetPath := req.GetTargetPath()
+	mountPoint, err := n.mountPoint(targetPath)
+	if err != nil {
+		return keepTargetMount, err
+	}
+	if slices.Contains(mountPoint.Opts, "ro") != slices.Contains(flags, "ro") {
+		return keepTargetMount, status.Errorf(codes.AlreadyExists, "volume %s is published at %s with another read only mode", req.GetVolumeId(), targetPath)
+	}
+
+	if block {
+		// The mount table names devtmpfs as the source of bind mounts of device nodes, compare the device numbers.
+		if !sameDeviceNode(targetPath, source) {
+			klog.V(3).Infof("Target path %s of volume %s isn't device %s", targetPath, req.GetVolumeId(), source)
+			return replaceTargetMount, nil
+		}
+	} else {
+		device, err := n.publishedDevice(ctx, req)
+		if err != nil {
+			return keepTargetMount, err
+		}
+		stagingSource, err := n.mountSource(req.GetStagingTargetPath())
+		if err != nil {
+			return keepTargetMount, err
+		}
+		if stagingSource != device.Path {
+			return keepTargetMount, status.Errorf(codes.FailedPrecondition, "volume %s is staged from device %s, but its disk is %s, it has to be unstaged first", req.GetVolumeId(), stagingSource, device.Path)
+		}
+		if mountPoint.Device != device.Path {
+			klog.V(3).Infof("Target path %s of volume %s is mounted from %s instead of %s", targetPath, req.GetVolumeId(), mountPoint.Device, device.Path)
+			return replaceTargetMount, nil
+		}
+	}
+	// A bind mount only takes new flags when it is remounted.
+	if differ, err := n.mountOptionsDiffer(targetPath, flags); err != nil || !differ {
+		return keepTargetMount, err
+	}
+	return remountTarget, nil
+}
+
+// sameDeviceNode tells whether path is the device node devicePath, or a bind mount of it. It returns false when either
+// can't be read.
+func sameDeviceNode(path, devicePath string) bool {
+	var pathStat, deviceStat unix.Stat_t
+	if err := unix.Stat(path, &pathStat); err != nil {
+		return false
+	}
+	if err := unix.Stat(devicePath, &deviceStat); err != nil {
+		return false
+	}
+	isDevice := deviceStat.Mode&unix.S_IFMT == unix.S_IFBLK || deviceStat.Mode&unix.S_IFMT == unix.S_IFCHR
+	return isDevice && pathStat.Mode&unix.S_IFMT == deviceStat.Mode&unix.S_IFMT && pathStat.Rdev == deviceStat.Rdev
+}
+
+// publishedDevice returns the device the volume lives on, which is the dm-crypt mapping for encrypted volumes.
+func (n *NodeService) publishedDevice(ctx context.Context, req *csi.NodePublishVolumeRequest) (device, error) {
+	// volumeID = serialID = kubevirt's DataVolume.metadata.uid
+	// TODO link to kubevirt code
+	device, err := n.waitForDevice(ctx, req.VolumeContext[serialParameter], req.VolumeContext[busParameter])
+	if err != nil {
+		klog.Errorf("failed to fetch device by serialID %s ", req.VolumeId)
+		return device, err
+	}
+	if isEncrypted(req.VolumeContext) {
+		// NodeStageVolume opened the mapping, publish what is on top of it.
+		device, err = getMappedDevice(req.VolumeContext[serialParameter], luksMapperName(req.VolumeId), n.deviceLister)
+		if err != nil {
+			klog.Errorf("failed to fetch LUKS mapping of volume %s", req.VolumeId)
+			return device, err
+		}
+	}
+	return device, nil
+}
+
+// ensureStaged mounts the filesystem at the staging path if it isn't mounted there. Earlier versions of the driver
+// mounted the device at every target path and left the staging path empty, their volumes are moved to the staging
+// path the next time they are published.
+func (n *NodeService) ensureStaged(ctx context.Context, req *csi.NodePublishVolumeRequest, flags []string) error {
+	stagingPath := req.GetStagingTargetPath()
+	notMnt, err := n.mounter.IsLikelyNotMountPoint(stagingPath)
+	if err != nil && !os.IsNotExist(err) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if !notMnt {
+		return nil
+	}
+	klog.V(3).Infof("Volume %s is not mounted at staging path %s, mounting it", req.VolumeId, stagingPath)
+	device, err := n.publishedDevice(ctx, req)
+	if err != nil {
+		return err
+	}
+	discard, err := discardMode(req.GetVolumeContext())
+	if err != nil {
+		return err
+	}
+	ownUUID := n.hasOwnFilesystemUUID(device, req.GetVolumeContext()[serialParameter])
+	return n.mountStagingPath(device, stagingPath, req.GetVolumeCapability().GetMount().GetFsType(), discardMountFlags(flags, discard), ownUUID)
+}
+
+// deviceMounted tells whether the device is mounted anywhere on the node.
+func (n *NodeService) deviceMounted(devicePath string) (bool, error) {
+	mountPoints, err := n.mounter.List()
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "failed to list mounts: %v", err)
+	}
+	for _, mountPoint := range mountPoints {
+		if mountPoint.Device == devicePath {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (n *NodeService) resizeFs(devicePath, targetPath string) error {
 	ok, err := n.resizer.NeedResize(devicePath, targetPath)
 	if err != nil {
@@ -328,7 +766,7 @@ func (n *NodeService) resizeFs(devicePath, targetPath string) error {
 	return nil
 }
 
-func (n *NodeService) mountToTargetPath(req *csi.NodePublishVolumeRequest, isBlock bool, targetPath string, device device, fsType string, mountOptions []string) error {
+func (n *NodeService) mountToTargetPath(req *csi.NodePublishVolumeRequest, isBlock bool, targetPath, source string, mountOptions []string) error {
 	if isBlock {
 		if err := n.ensureMountFileExists(targetPath); err != nil {
 			return err
@@ -339,11 +777,10 @@ func (n *NodeService) mountToTargetPath(req *csi.NodePublishVolumeRequest, isBlo
 			return err
 		}
 		klog.V(3).Infof("GetMount() %v", req.VolumeCapability.GetMount())
-		klog.V(3).Infof("Mounting devicePath %s, on targetPath: %s with FS type: %s",
-			device, targetPath, fsType)
 	}
 
-	if err := n.mounter.Mount(device.Path, targetPath, fsType, mountOptions); err != nil {
+	klog.V(3).Infof("Bind mounting %s on targetPath: %s", source, targetPath)
+	if err := n.mounter.Mount(source, targetPath, "", mountOptions); err != nil {
 		klog.Errorf("failed mounting %v", err)
 		return err
 	}
@@ -410,6 +847,7 @@ func (n *NodeService) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpu
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
+// NodeGetVolumeStats returns the usage of the volume and, if the node service checks it, its condition.
 func (n *NodeService) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
 	klog.V(4).InfoS("NodeGetVolumeStats: called", "args", req)
 	if len(req.GetVolumeId()) == 0 {
@@ -432,9 +870,17 @@ func (n *NodeService) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to determine whether %s is block device: %v", req.GetVolumePath(), err)
 	}
+	var condition *csi.VolumeCondition
+	if n.volumeConditionChecker != nil {
+		condition = n.volumeConditionChecker.Condition(req.GetVolumePath(), isBlock)
+	}
 	if isBlock {
 		bcap, blockErr := n.mounter.GetBlockSizeBytes(req.GetVolumePath())
 		if blockErr != nil {
+			if condition.GetAbnormal() {
+				// The usage of a broken volume is unknown, its condition is what matters.
+				return &csi.NodeGetVolumeStatsResponse{VolumeCondition: condition}, nil
+			}
 			return nil, status.Errorf(codes.Internal, "failed to get block capacity on path %s: %v", req.GetVolumePath(), blockErr)
 		}
 		return &csi.NodeGetVolumeStatsResponse{
@@ -444,11 +890,15 @@ func (n *NodeService) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 					Total: bcap,
 				},
 			},
+			VolumeCondition: condition,
 		}, nil
 	}
 
 	stats, err := n.mounter.GetVolumeStats(req.GetVolumePath())
 	if err != nil {
+		if condition.GetAbnormal() {
+			return &csi.NodeGetVolumeStatsResponse{VolumeCondition: condition}, nil
+		}
 		return nil, status.Errorf(codes.Internal, "failed to get fs info on path %s: %v", req.GetVolumePath(), err)
 	}
 
@@ -470,11 +920,12 @@ func (n *NodeService) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolu
 	}
 
 	return &csi.NodeGetVolumeStatsResponse{
-		Usage: usage,
+		Usage:           usage,
+		VolumeCondition: condition,
 	}, nil
 }
 
-// NodeExpandVolume only gets invoked for filesystem volumes and takes care of expanding the filesystem
+// NodeExpandVolume makes the guest kernel notice the bigger disk and expands the filesystem of filesystem volumes
 func (n *NodeService) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
 	volumeID := req.GetVolumeId()
 	volumePath := req.GetVolumePath()
@@ -486,10 +937,35 @@ func (n *NodeService) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandV
 		return nil, status.Error(codes.InvalidArgument, "no volume_path is provided")
 	}
 
+	requiredBytes := req.GetCapacityRange().GetRequiredBytes()
+
 	block := req.GetVolumeCapability().GetBlock() != nil
 	if block {
-		klog.V(2).Infof("NodeExpandVolume is not needed for block volume %s", volumeID)
-		return &csi.NodeExpandVolumeResponse{}, nil
+		mapperName := luksMapperName(volumeID)
+		encrypted, err := n.encryptor.IsOpen(mapperName)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to check LUKS mapping %s: %v", mapperName, err)
+		}
+		// The volume path of a block volume is a bind mount of the device node, the LUKS mapping for encrypted volumes,
+		// whose disk is only known by its serial.
+		stagingSource := volumePath
+		if encrypted {
+			stagingSource = ""
+		}
+		diskPath, err := n.stagedDevicePath(volumeID, stagingSource)
+		if err != nil {
+			return nil, err
+		}
+		size, err := n.waitForDeviceSize(ctx, volumeID, diskPath, requiredBytes)
+		if err != nil {
+			return nil, err
+		}
+		if encrypted {
+			if size, err = n.resizeLUKSMapping(mapperName, req.GetSecrets(), size); err != nil {
+				return nil, err
+			}
+		}
+		return &csi.NodeExpandVolumeResponse{CapacityBytes: size}, nil
 	}
 
 	devicePath, err := n.devicePathGetter.Get(volumePath)
@@ -499,18 +975,62 @@ func (n *NodeService) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandV
 		}
 		return nil, status.Errorf(codes.NotFound, "device path for %s not found", volumePath)
 	}
+	mapperName, encrypted := strings.CutPrefix(devicePath, devMapperDir)
+	encrypted = encrypted && strings.HasPrefix(mapperName, luksMapperPrefix)
+
+	// The disk of an encrypted volume is only known by its serial, its filesystem is on the LUKS mapping.
+	stagingSource := devicePath
+	if encrypted {
+		stagingSource = ""
+	}
+	diskPath, err := n.stagedDevicePath(volumeID, stagingSource)
+	if err != nil {
+		return nil, err
+	}
+	size, err := n.waitForDeviceSize(ctx, volumeID, diskPath, requiredBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// The filesystem of an encrypted volume can only grow once the dm-crypt mapping covers the bigger device.
+	if encrypted {
+		if size, err = n.resizeLUKSMapping(mapperName, req.GetSecrets(), size); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := n.resizeFs(devicePath, volumePath); err != nil {
 		return nil, err
 	}
 
-	return &csi.NodeExpandVolumeResponse{}, nil
+	return &csi.NodeExpandVolumeResponse{CapacityBytes: size}, nil
+}
+
+// resizeLUKSMapping grows the dm-crypt mapping to cover its expanded disk of diskSize bytes, and returns the size of
+// the mapping, which is smaller than the disk by the size of the LUKS header.
+func (n *NodeService) resizeLUKSMapping(mapperName string, secrets map[string]string, diskSize int64) (int64, error) {
+	klog.V(3).Infof("Resizing LUKS mapping %s", mapperName)
+	if err := n.encryptor.Resize(mapperName, secrets[encryptionPassphraseKey]); err != nil {
+		return 0, status.Errorf(codes.Internal, "failed to resize LUKS mapping %s: %v", mapperName, err)
+	}
+	if n.deviceSizer == nil || diskSize == 0 {
+		return diskSize, nil
+	}
+	mappedPath := devMapperDir + mapperName
+	size, err := n.deviceSizer.Size(mappedPath)
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "failed to read the size of device %s: %v", mappedPath, err)
+	}
+	return size, nil
 }
 
-// NodeGetInfo returns the node ID
+// NodeGetInfo returns the node ID and how many volumes can be attached to the node
 func (n *NodeService) NodeGetInfo(context.Context, *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
 	// the nodeID is the VM's ID in kubevirt or VMI.spec.domain.firmware.uuid
-	return &csi.NodeGetInfoResponse{NodeId: n.nodeID}, nil
+	return &csi.NodeGetInfoResponse{
+		NodeId:            n.nodeID,
+		MaxVolumesPerNode: n.maxVolumesPerNode,
+	}, nil
 }
 
 // NodeGetCapabilities returns the supported capabilities of the node service
@@ -536,10 +1056,11 @@ type devices struct {
 }
 
 type device struct {
-	SerialID string `json:"serial"`
-	Path     string `json:"path,omitempty"`
-	Name     string `json:"name"`
-	Fstype   string `json:"fstype"`
+	SerialID string   `json:"serial"`
+	Path     string   `json:"path,omitempty"`
+	Name     string   `json:"name"`
+	Fstype   string   `json:"fstype"`
+	Children []device `json:"children,omitempty"`
 }
 
 func getDeviceBySerialID(serialID string, deviceLister DeviceLister) (device, error) {
@@ -549,7 +1070,7 @@ func getDeviceBySerialID(serialID string, deviceLister DeviceLister) (device, er
 	if err != nil {
 		var exitError *exec.ExitError
 		if errors.As(err, &exitError) {
-			return device{}, errors.New(err.Error() + " lsblk failed with " + string(exitError.Stderr))
+			return device{}, errors.New(err.Error() + " device listing failed with " + string(exitError.Stderr))
 		}
 		return device{}, err
 	}
@@ -557,7 +1078,7 @@ func getDeviceBySerialID(serialID string, deviceLister DeviceLister) (device, er
 	devices := devices{}
 	err = json.Unmarshal(out, &devices)
 	if err != nil {
-		klog.Errorf("failed to parse json output from lsblk: %s", err)
+		klog.Errorf("failed to parse the device list: %s", err)
 		return device{}, err
 	}
 
@@ -567,37 +1088,5 @@ func getDeviceBySerialID(serialID string, deviceLister DeviceLister) (device, er
 			return d, nil
 		}
 	}
-	return device{}, errors.New("couldn't find device by serial id")
-}
-
-func makeFS(device string, fsType string) error {
-	// caution, use force flag when creating the filesystem if it doesn't exit.
-	klog.Infof("Mounting device %s, with FS %s", device, fsType)
-
-	var cmd *exec.Cmd
-	var stdout, stderr bytes.Buffer
-	if strings.HasPrefix(fsType, "ext4") {
-		// Don't reserve root space on ext4, since these volumes are mounted it makes no sense
-		// to reserve the space.
-		cmd = exec.Command("mkfs", "-m", "0", "-F", "-t", fsType, device)
-	} else if strings.HasPrefix(fsType, "xfs") {
-		cmd = exec.Command("mkfs", "-t", fsType, "-f", device)
-	} else {
-		return errors.New(fsType + " is not supported, only xfs and ext4 are supported")
-	}
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
-	if err != nil {
-		var exitError *exec.ExitError
-		if errors.As(err, &exitError) {
-			klog.Errorf("stdout: %s", stdout.String())
-			klog.Errorf("stderr: %s", stderr.String())
-			return errors.New(err.Error() + " mkfs failed with " + exitError.Error())
-		}
-		return err
-	}
-
-	return nil
+	return device{}, errDeviceNotFound
 }
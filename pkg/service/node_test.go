@@ -5,9 +5,18 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	mount "k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -34,7 +43,7 @@ var _ = Describe("NodeService", func() {
 			nodeID: "vm-worker-0-0",
 		}
 		underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
-			json := fmt.Sprintf("{\"blockdevices\": [{\"serial\":\"%s\", \"path\":\"%s\", \"fstype\":null}]}", serialID, "/dev/sdc")
+			json := fmt.Sprintf("{\"blockdevices\": [{\"serial\":\"%s\", \"name\":\"%s\", \"fstype\":null}]}", serialID, "sdc")
 			return []byte(json), nil
 		})
 		underTest.dirMaker = dirMakerFunc(func(string, os.FileMode) error {
@@ -45,6 +54,7 @@ var _ = Describe("NodeService", func() {
 		})
 		underTest.mounter = &successfulMounter{}
 		underTest.resizer = noopResizer{}
+		underTest.encryptor = &fakeEncryptor{}
 	})
 
 	Context("Staging a volume", func() {
@@ -92,7 +102,7 @@ var _ = Describe("NodeService", func() {
 			})
 
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("lsblk failed with"))
+			Expect(err.Error()).To(ContainSubstring("device listing failed with"))
 			Expect(err.Error()).To(ContainSubstring("lsblk: permission denied"))
 		})
 
@@ -120,7 +130,7 @@ var _ = Describe("NodeService", func() {
 		})
 
 		It("should fail with failure to make new filesystem", func() {
-			underTest.fsMaker = fsMakerFunc(func(device, path string) error {
+			underTest.fsMaker = fsMakerFunc(func(device, path string, options []string) error {
 				return fmt.Errorf("unknown fs")
 			})
 			_, err := underTest.NodeStageVolume(context.TODO(), &csi.NodeStageVolumeRequest{
@@ -139,7 +149,7 @@ var _ = Describe("NodeService", func() {
 		})
 
 		It("should succeed successful make new filesystem", func() {
-			underTest.fsMaker = fsMakerFunc(func(device, path string) error {
+			underTest.fsMaker = fsMakerFunc(func(device, path string, options []string) error {
 				return nil
 			})
 			res, err := underTest.NodeStageVolume(context.TODO(), &csi.NodeStageVolumeRequest{
@@ -157,61 +167,994 @@ var _ = Describe("NodeService", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(res).ToNot(BeNil())
 		})
+
+		It("should pass the mkfsOptions to mkfs", func() {
+			var mkfsOptions []string
+			underTest.fsMaker = fsMakerFunc(func(device, fsType string, options []string) error {
+				mkfsOptions = options
+				return nil
+			})
+			req := newStageRequest()
+			req.VolumeContext[mkfsOptionsParameter] = "-i 65536 -E lazy_itable_init=0"
+			_, err := underTest.NodeStageVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mkfsOptions).To(Equal([]string{"-i", "65536", "-E", "lazy_itable_init=0"}))
+		})
+
+		It("should reject mkfsOptions that aren't allowed", func() {
+			underTest.fsMaker = fsMakerFunc(func(device, fsType string, options []string) error {
+				Fail("mkfs must not run with invalid options")
+				return nil
+			})
+			req := newStageRequest()
+			req.VolumeContext[mkfsOptionsParameter] = "-F /dev/sda"
+			_, err := underTest.NodeStageVolume(context.TODO(), req)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+
+		It("should mount the filesystem at the staging path", func() {
+			mounter := &successfulMounter{}
+			underTest.mounter = mounter
+			underTest.fsMaker = fsMakerFunc(func(device, path string, options []string) error {
+				return nil
+			})
+			_, err := underTest.NodeStageVolume(context.TODO(), newStageRequest())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.mounts).To(Equal(map[string]string{"/staging/path": "/dev/sdc"}))
+		})
+
+		It("should mount the staging path with the mount flags", func() {
+			mounter := &successfulMounter{}
+			underTest.mounter = mounter
+			underTest.fsMaker = fsMakerFunc(func(device, fsType string, options []string) error {
+				return nil
+			})
+			req := newStageRequest()
+			req.VolumeCapability.GetMount().FsType = "xfs"
+			req.VolumeCapability.GetMount().MountFlags = []string{"noatime", "nouuid", "discard"}
+			_, err := underTest.NodeStageVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.options["/staging/path"]).To(Equal([]string{"nouuid", "noatime", "discard"}))
+		})
+
+		It("should remount the staging path when it lacks mount flags", func() {
+			mounter := &successfulMounter{
+				mounts:  map[string]string{"/staging/path": "/dev/sdc"},
+				options: map[string][]string{"/staging/path": {"rw", "relatime"}},
+			}
+			underTest.mounter = mounter
+			underTest.fsMaker = fsMakerFunc(func(device, fsType string, options []string) error {
+				return nil
+			})
+			req := newStageRequest()
+			req.VolumeCapability.GetMount().MountFlags = []string{"noatime"}
+			_, err := underTest.NodeStageVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.options["/staging/path"]).To(Equal([]string{"remount", "noatime"}))
+		})
+
+		It("should not remount the staging path for the options the kernel adds", func() {
+			mounter := &successfulMounter{
+				mounts:  map[string]string{"/staging/path": "/dev/sdc"},
+				options: map[string][]string{"/staging/path": {"rw", "seclabel", "noatime", "attr2", "inode64", "logbufs=8", "noquota"}},
+			}
+			underTest.mounter = mounter
+			underTest.fsMaker = fsMakerFunc(func(device, fsType string, options []string) error {
+				return nil
+			})
+			req := newStageRequest()
+			req.VolumeCapability.GetMount().MountFlags = []string{"defaults", "noatime", "exec"}
+			_, err := underTest.NodeStageVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.options["/staging/path"]).ToNot(ContainElement("remount"))
+		})
+
+		DescribeTable("should reject mount flags", func(flags ...string) {
+			req := newStageRequest()
+			req.VolumeCapability.GetMount().MountFlags = flags
+			_, err := underTest.NodeStageVolume(context.TODO(), req)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		},
+			Entry("allowing setuid binaries", "suid"),
+			Entry("changing the mount propagation", "rshared"),
+			Entry("bind mounting", "bind"),
+			Entry("that conflict", "ro", "rw"),
+		)
+
+		It("should continue to resize call despite the staging mount existing", func() {
+			// Simulates a retry of NodeStageVolume following an error during resize
+			resizer := &successfulResizer{}
+			underTest.resizer = resizer
+			underTest.mounter = &noopMounter{}
+			underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
+				json := fmt.Sprintf("{\"blockdevices\": [{\"serial\":\"%s\", \"name\":\"sdc\", \"fstype\":\"ext4\"}]}", serialID)
+				return []byte(json), nil
+			})
+			_, err := underTest.NodeStageVolume(context.TODO(), newStageRequest())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(underTest.mounter.(*noopMounter).mountOccured).To(BeFalse())
+			Expect(resizer.resizeOccured).To(BeTrue())
+		})
+	})
+
+	Context("Waiting for the device", func() {
+		var (
+			rescanner *fakeRescanner
+			request   *csi.NodeStageVolumeRequest
+		)
+
+		BeforeEach(func() {
+			rescanner = &fakeRescanner{}
+			underTest.deviceRescanner = rescanner
+			underTest.fsMaker = fsMakerFunc(func(device, path string, options []string) error {
+				return nil
+			})
+			// The device only shows up once the bus has been rescanned.
+			underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
+				if len(rescanner.buses) == 0 {
+					return []byte("{\"blockdevices\": []}"), nil
+				}
+				json := fmt.Sprintf("{\"blockdevices\": [{\"serial\":\"%s\", \"name\":\"sdc\", \"fstype\":null}]}", serialID)
+				return []byte(json), nil
+			})
+			request = &csi.NodeStageVolumeRequest{
+				VolumeId: "pvc-123",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+				},
+				VolumeContext:     map[string]string{serialParameter: serialID, busParameter: "scsi"},
+				StagingTargetPath: "/invalid/staging",
+			}
+		})
+
+		It("should rescan the bus and wait for the device to appear", func() {
+			underTest.deviceWaitTimeout = 5 * time.Second
+
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rescanner.buses).To(Equal([]string{"scsi"}))
+		})
+
+		It("should return Unavailable when the device doesn't appear in time", func() {
+			underTest.deviceWaitTimeout = 100 * time.Millisecond
+			rescanner.err = fmt.Errorf("rescan failed")
+			underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
+				return []byte("{\"blockdevices\": []}"), nil
+			})
+
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).To(HaveOccurred())
+			Expect(status.Code(err)).To(Equal(codes.Unavailable))
+			Expect(err.Error()).To(ContainSubstring("has not appeared on node vm-worker-0-0"))
+		})
+
+		It("should not wait without a timeout", func() {
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(status.Code(err)).To(Equal(codes.Unavailable))
+			Expect(rescanner.buses).To(BeEmpty())
+		})
+	})
+
+	Context("Checking the filesystem", func() {
+		var (
+			checker  *fakeFsChecker
+			recorder *fakeEventRecorder
+			request  *csi.NodeStageVolumeRequest
+		)
+
+		BeforeEach(func() {
+			checker = &fakeFsChecker{}
+			recorder = &fakeEventRecorder{}
+			underTest.fsChecker = checker
+			underTest.eventRecorder = recorder
+			underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
+				json := fmt.Sprintf("{\"blockdevices\": [{\"serial\":\"%s\", \"name\":\"sdc\", \"fstype\":\"ext4\"}]}", serialID)
+				return []byte(json), nil
+			})
+			request = newStageRequest()
+		})
+
+		It("should not check the filesystem without a policy", func() {
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checker.checked).To(BeEmpty())
+		})
+
+		It("should check the filesystem before mounting it", func() {
+			request.VolumeContext[fsckPolicyParameter] = fsckPolicyCheck
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checker.checked).To(Equal([]string{"/dev/sdc"}))
+			Expect(checker.repair).To(BeFalse())
+			Expect(recorder.events).To(ConsistOf(ContainSubstring("Normal FilesystemChecked")))
+		})
+
+		It("should repair the filesystem with the repair policy", func() {
+			request.VolumeContext[fsckPolicyParameter] = fsckPolicyRepair
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checker.repair).To(BeTrue())
+		})
+
+		It("should refuse to mount a filesystem that fails the check", func() {
+			mounter := &successfulMounter{}
+			underTest.mounter = mounter
+			checker.err = fmt.Errorf("fsck failed: exit status 4")
+			request.VolumeContext[fsckPolicyParameter] = fsckPolicyCheck
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+			Expect(mounter.mounts).To(BeEmpty())
+			Expect(recorder.events).To(ConsistOf(ContainSubstring("Warning FilesystemCheckFailed")))
+		})
+
+		It("should not check a filesystem that is mounted", func() {
+			underTest.mounter = &successfulMounter{mounts: map[string]string{"/var/lib/kubelet/pods/target": "/dev/sdc"}}
+			request.VolumeContext[fsckPolicyParameter] = fsckPolicyCheck
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checker.checked).To(BeEmpty())
+		})
+
+		It("should not check a new filesystem", func() {
+			underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
+				json := fmt.Sprintf("{\"blockdevices\": [{\"serial\":\"%s\", \"name\":\"sdc\", \"fstype\":null}]}", serialID)
+				return []byte(json), nil
+			})
+			underTest.fsMaker = fsMakerFunc(func(device, fsType string, options []string) error {
+				return nil
+			})
+			request.VolumeContext[fsckPolicyParameter] = fsckPolicyCheck
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(checker.checked).To(BeEmpty())
+		})
+
+		It("should reject an unknown policy", func() {
+			request.VolumeContext[fsckPolicyParameter] = "always"
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Context("Staging a device that holds other data", func() {
+		var (
+			devDir    string
+			formatted []string
+		)
+
+		BeforeEach(func() {
+			sysDir := GinkgoT().TempDir()
+			devDir = GinkgoT().TempDir()
+			Expect(os.MkdirAll(filepath.Join(sysDir, "sdc"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(sysDir, "sdc", "serial"), []byte(serialID), 0644)).To(Succeed())
+			underTest.deviceLister = &sysfsDeviceLister{sysBlockDir: sysDir, devDir: devDir}
+			formatted = nil
+			underTest.fsMaker = fsMakerFunc(func(device, fsType string, options []string) error {
+				formatted = append(formatted, device)
+				return nil
+			})
+		})
+
+		DescribeTable("should refuse to format it", func(offset int, magic string) {
+			content := make([]byte, 4*blankProbeSize)
+			copy(content[offset:], magic)
+			Expect(os.WriteFile(filepath.Join(devDir, "sdc"), content, 0644)).To(Succeed())
+
+			_, err := underTest.NodeStageVolume(context.TODO(), newStageRequest())
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+			Expect(formatted).To(BeEmpty())
+		},
+			Entry("LVM physical volume", 0x218, "LVM2 001"),
+			Entry("GPT partition table", 512, "EFI PART"),
+			Entry("swap space", 4086, "SWAPSPACE2"),
+			Entry("FAT filesystem the volume doesn't ask for", 82, "FAT32   "),
+		)
+
+		It("should mount a FAT filesystem when the volume asks for vfat", func() {
+			content := make([]byte, 4*blankProbeSize)
+			copy(content[82:], "FAT32   ")
+			Expect(os.WriteFile(filepath.Join(devDir, "sdc"), content, 0644)).To(Succeed())
+			mounter := &successfulMounter{}
+			underTest.mounter = mounter
+
+			request := newStageRequest()
+			request.VolumeCapability.GetMount().FsType = "vfat"
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(formatted).To(BeEmpty())
+			Expect(mounter.mounts).To(HaveKeyWithValue("/staging/path", "/dev/sdc"))
+		})
+
+		It("should format a blank device", func() {
+			Expect(os.WriteFile(filepath.Join(devDir, "sdc"), make([]byte, 4*blankProbeSize), 0644)).To(Succeed())
+
+			_, err := underTest.NodeStageVolume(context.TODO(), newStageRequest())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(formatted).To(Equal([]string{"/dev/sdc"}))
+		})
 	})
 
-	Context("Publishing a volume", func() {
-		It("should fail with non-matching serial ID", func() {
-			res, err := underTest.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
-				VolumeId:      "pvc-123",
-				VolumeContext: map[string]string{serialParameter: "serial000"},
-			})
-			Expect(err).To(HaveOccurred())
-			Expect(res).To(BeNil())
+	Context("Releasing the device on unstage", func() {
+		var (
+			mounter  *successfulMounter
+			store    *fileStateStore
+			releaser *fakeDeviceReleaser
+			request  *csi.NodeUnstageVolumeRequest
+		)
+
+		BeforeEach(func() {
+			mounter = &successfulMounter{mounts: map[string]string{"/staging/path": "/dev/sdc"}}
+			store = &fileStateStore{dir: GinkgoT().TempDir()}
+			releaser = &fakeDeviceReleaser{}
+			underTest.mounter = mounter
+			underTest.stateStore = store
+			underTest.deviceReleaser = releaser
+			Expect(store.Save(VolumeState{VolumeID: "pvc-123", StagingPath: "/staging/path", Serial: serialID})).To(Succeed())
+			request = &csi.NodeUnstageVolumeRequest{VolumeId: "pvc-123", StagingTargetPath: "/staging/path"}
+		})
+
+		It("should flush the device once it is unused", func() {
+			_, err := underTest.NodeUnstageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.unmounted).To(Equal([]string{"/staging/path"}))
+			Expect(releaser.flushed).To(Equal([]string{"/dev/sdc"}))
+			Expect(store.List()).To(BeEmpty())
+		})
+
+		It("should refuse to unstage a device that is still mounted", func() {
+			mounter.mounts["/var/lib/kubelet/pods/uid/volumes/pvc-123/mount"] = "/dev/sdc"
+			_, err := underTest.NodeUnstageVolume(context.TODO(), request)
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+			Expect(err.Error()).To(ContainSubstring("still mounted at /var/lib/kubelet/pods/uid/volumes/pvc-123/mount"))
+			Expect(releaser.flushed).To(BeEmpty())
+			// The state is kept, so the retry still finds the device.
+			Expect(store.List()).To(HaveLen(1))
+		})
+
+		It("should refuse to unstage a device that is still held", func() {
+			releaser.holders = []string{"dm-3"}
+			_, err := underTest.NodeUnstageVolume(context.TODO(), request)
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+			Expect(err.Error()).To(ContainSubstring("still held by dm-3"))
+			Expect(releaser.flushed).To(BeEmpty())
+		})
+
+		It("should fail when the device can't be flushed", func() {
+			releaser.err = fmt.Errorf("blockdev --flushbufs failed")
+			_, err := underTest.NodeUnstageVolume(context.TODO(), request)
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+		})
+
+		It("should succeed when the device is gone", func() {
+			underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
+				return []byte(`{"blockdevices": []}`), nil
+			})
+			_, err := underTest.NodeUnstageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(releaser.flushed).To(BeEmpty())
+		})
+
+		It("should refuse to close the LUKS mapping of a volume that is still mounted", func() {
+			encryptor := &fakeEncryptor{open: true}
+			underTest.encryptor = encryptor
+			mounter.mounts["/staging/path"] = "/dev/mapper/luks-pvc-123"
+			mounter.mounts["/var/lib/kubelet/pods/uid/volumes/pvc-123/mount"] = "/dev/mapper/luks-pvc-123"
+			_, err := underTest.NodeUnstageVolume(context.TODO(), request)
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+			Expect(err.Error()).To(ContainSubstring("device /dev/mapper/luks-pvc-123 of volume pvc-123 is still mounted"))
+			Expect(encryptor.open).To(BeTrue())
+			Expect(releaser.flushed).To(BeEmpty())
+		})
+
+		It("should refuse to close the LUKS mapping of a volume that is still held", func() {
+			encryptor := &fakeEncryptor{open: true}
+			underTest.encryptor = encryptor
+			mounter.mounts["/staging/path"] = "/dev/mapper/luks-pvc-123"
+			releaser.holders = []string{"dm-7"}
+			_, err := underTest.NodeUnstageVolume(context.TODO(), request)
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+			Expect(err.Error()).To(ContainSubstring("device /dev/mapper/luks-pvc-123 of volume pvc-123 is still held by dm-7"))
+			Expect(encryptor.open).To(BeTrue())
+		})
+
+		It("should close the LUKS mapping before it releases the disk", func() {
+			encryptor := &fakeEncryptor{open: true}
+			underTest.encryptor = encryptor
+			mounter.mounts["/staging/path"] = "/dev/mapper/luks-pvc-123"
+			_, err := underTest.NodeUnstageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encryptor.open).To(BeFalse())
+			Expect(releaser.flushed).To(Equal([]string{"/dev/sdc"}))
+		})
+
+		It("should find the device of volumes staged without state by their staging mount", func() {
+			devicePath := filepath.Join(GinkgoT().TempDir(), "sdd")
+			Expect(os.WriteFile(devicePath, nil, 0600)).To(Succeed())
+			mounter.mounts["/staging/path"] = devicePath
+			Expect(store.Delete("pvc-123")).To(Succeed())
+			_, err := underTest.NodeUnstageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(releaser.flushed).To(Equal([]string{devicePath}))
+		})
+	})
+
+	Context("Discarding unused blocks", func() {
+		var (
+			mounter *successfulMounter
+			store   *fileStateStore
+			request *csi.NodeStageVolumeRequest
+		)
+
+		BeforeEach(func() {
+			mounter = &successfulMounter{}
+			store = &fileStateStore{dir: GinkgoT().TempDir()}
+			underTest.mounter = mounter
+			underTest.stateStore = store
+			underTest.fsMaker = fsMakerFunc(func(device, fsType string, options []string) error {
+				return nil
+			})
+			request = newStageRequest()
+		})
+
+		It("should mount the filesystem with discard", func() {
+			request.VolumeContext[discardParameter] = discardOnline
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.options["/staging/path"]).To(ContainElement("discard"))
+		})
+
+		It("should remember the volumes to trim until they are unstaged", func() {
+			request.VolumeContext[discardParameter] = discardFstrim
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.options["/staging/path"]).ToNot(ContainElement("discard"))
+			Expect(store.List()).To(ConsistOf(VolumeState{VolumeID: "pvc-123", StagingPath: "/staging/path", Serial: serialID, Discard: discardFstrim}))
+
+			underTest.encryptor = &fakeEncryptor{}
+			_, err = underTest.NodeUnstageVolume(context.TODO(), &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "pvc-123",
+				StagingTargetPath: "/staging/path",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(store.List()).To(BeEmpty())
+		})
+	})
+
+	Context("Applying the volume mount group", func() {
+		var (
+			request     *csi.NodeStageVolumeRequest
+			stagingPath string
+		)
+
+		BeforeEach(func() {
+			stagingPath = GinkgoT().TempDir()
+			Expect(os.Mkdir(filepath.Join(stagingPath, "data"), 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(stagingPath, "data", "file"), nil, 0600)).To(Succeed())
+			underTest.mounter = &successfulMounter{}
+			underTest.fsMaker = fsMakerFunc(func(device, fsType string, options []string) error {
+				return nil
+			})
+			request = newStageRequest()
+			request.StagingTargetPath = stagingPath
+			request.VolumeCapability.GetMount().VolumeMountGroup = strconv.Itoa(os.Getgid())
+		})
+
+		It("should give the group access to the files of the volume", func() {
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			info, err := os.Stat(filepath.Join(stagingPath, "data"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode() & (0770 | os.ModeSetgid)).To(Equal(0770 | os.ModeSetgid))
+			info, err = os.Stat(filepath.Join(stagingPath, "data", "file"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0660)))
+		})
+
+		It("should not walk the volume when its root has the group already", func() {
+			Expect(os.Chmod(stagingPath, 0770|os.ModeSetgid)).To(Succeed())
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			info, err := os.Stat(filepath.Join(stagingPath, "data", "file"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("should not change read only volumes", func() {
+			request.VolumeCapability.AccessMode = &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY}
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			info, err := os.Stat(filepath.Join(stagingPath, "data", "file"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("should give each published pod its group", func() {
+			secondGroup := -1
+			if os.Geteuid() == 0 {
+				secondGroup = os.Getgid() + 1
+			} else if groups, err := os.Getgroups(); err == nil {
+				for _, group := range groups {
+					if group != os.Getgid() {
+						secondGroup = group
+					}
+				}
+			}
+			if secondGroup < 0 {
+				Skip("there is no other group to give the files to")
+			}
+			underTest.mounter = &successfulMounter{mounts: map[string]string{stagingPath: "/dev/sdc"}}
+			fileGroup := func() int {
+				info, err := os.Stat(filepath.Join(stagingPath, "data", "file"))
+				Expect(err).ToNot(HaveOccurred())
+				return int(info.Sys().(*syscall.Stat_t).Gid)
+			}
+
+			for i, gid := range []int{os.Getgid(), secondGroup} {
+				publishRequest := newPublishRequest()
+				publishRequest.StagingTargetPath = stagingPath
+				publishRequest.TargetPath = fmt.Sprintf("/target/path-%d", i)
+				publishRequest.VolumeCapability.GetMount().VolumeMountGroup = strconv.Itoa(gid)
+				_, err := underTest.NodePublishVolume(context.TODO(), publishRequest)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fileGroup()).To(Equal(gid))
+			}
+		})
+
+		It("should advertise the volume mount group capability", func() {
+			response, err := underTest.NodeGetCapabilities(context.TODO(), &csi.NodeGetCapabilitiesRequest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.GetCapabilities()).To(ContainElement(HaveField("GetRpc().GetType()", csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP)))
+		})
+
+		It("should reject a group that isn't a group ID", func() {
+			request.VolumeCapability.GetMount().VolumeMountGroup = "wheel"
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Context("Regenerating the filesystem UUID", func() {
+		var (
+			changer  *fakeFsUUIDChanger
+			mounter  *successfulMounter
+			recorder *fakeEventRecorder
+			request  *csi.NodeStageVolumeRequest
+		)
+
+		BeforeEach(func() {
+			changer = &fakeFsUUIDChanger{uuid: "0d6b3f8e-4a1c-4f5e-9d2b-6c7a8e9f0a1b"}
+			mounter = &successfulMounter{}
+			recorder = &fakeEventRecorder{}
+			underTest.fsUUIDChanger = changer
+			underTest.mounter = mounter
+			underTest.eventRecorder = recorder
+			underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
+				json := fmt.Sprintf("{\"blockdevices\": [{\"serial\":\"%s\", \"name\":\"sdc\", \"fstype\":\"xfs\"}]}", serialID)
+				return []byte(json), nil
+			})
+			request = newStageRequest()
+			request.VolumeCapability.GetMount().FsType = "xfs"
+			request.VolumeContext[contentSourceParameter] = contentSourceSnapshot
+		})
+
+		It("should give a restored filesystem the serial of the volume as UUID", func() {
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changer.set).To(Equal([]string{"/dev/sdc=" + serialID}))
+			// The log of the xfs filesystem is replayed before its UUID is changed.
+			Expect(mounter.unmounted).To(Equal([]string{"/staging/path"}))
+			Expect(mounter.mounts).To(HaveKeyWithValue("/staging/path", "/dev/sdc"))
+			Expect(mounter.options["/staging/path"]).ToNot(ContainElement("nouuid"))
+			Expect(recorder.events).To(ConsistOf(ContainSubstring("Normal FilesystemUUIDChanged")))
+		})
+
+		It("should not change the UUID again", func() {
+			changer.uuid = strings.ToUpper(serialID)
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changer.set).To(BeEmpty())
+			Expect(mounter.options["/staging/path"]).ToNot(ContainElement("nouuid"))
+		})
+
+		It("should not change the UUID of a volume that wasn't copied", func() {
+			delete(request.VolumeContext, contentSourceParameter)
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changer.set).To(BeEmpty())
+			Expect(mounter.options["/staging/path"]).To(ContainElement("nouuid"))
+		})
+
+		It("should not change the UUID of a read only volume", func() {
+			request.VolumeCapability.AccessMode = &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY}
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changer.set).To(BeEmpty())
+		})
+
+		It("should not change the UUID of a mounted filesystem", func() {
+			mounter.mounts = map[string]string{"/var/lib/kubelet/pods/target": "/dev/sdc"}
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changer.set).To(BeEmpty())
+			Expect(mounter.options["/staging/path"]).To(ContainElement("nouuid"))
+		})
+
+		It("should fail staging when the UUID can't be changed", func() {
+			changer.err = fmt.Errorf("tune2fs failed: exit status 1: This operation requires a freshly checked filesystem.")
+			_, err := underTest.NodeStageVolume(context.TODO(), request)
+			Expect(err).To(HaveOccurred())
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+			Expect(err.Error()).To(ContainSubstring("freshly checked"))
+			Expect(mounter.mounts).ToNot(HaveKey("/staging/path"))
+			Expect(recorder.events).To(ConsistOf(ContainSubstring("Warning FilesystemUUIDNotChanged")))
+		})
+	})
+
+	Context("Staging an encrypted volume", func() {
+		var encryptor *fakeEncryptor
+
+		BeforeEach(func() {
+			encryptor = &fakeEncryptor{}
+			underTest.encryptor = encryptor
+			underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
+				if !encryptor.formatted {
+					return []byte(fmt.Sprintf("{\"blockdevices\": [{\"serial\":\"%s\", \"path\":\"/dev/sdc\", \"fstype\":null}]}", serialID)), nil
+				}
+				children := ""
+				if encryptor.open {
+					children = ", \"children\": [{\"name\":\"luks-pvc-123\", \"fstype\":null}]"
+				}
+				return []byte(fmt.Sprintf("{\"blockdevices\": [{\"serial\":\"%s\", \"path\":\"/dev/sdc\", \"fstype\":\"crypto_LUKS\"%s}]}", serialID, children)), nil
+			})
+		})
+
+		newEncryptedStageRequest := func() *csi.NodeStageVolumeRequest {
+			return &csi.NodeStageVolumeRequest{
+				VolumeId: "pvc-123",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{
+							FsType: "ext4",
+						},
+					},
+				},
+				VolumeContext:     map[string]string{serialParameter: serialID, encryptedParameter: "true"},
+				Secrets:           map[string]string{encryptionPassphraseKey: "secret"},
+				StagingTargetPath: "/invalid/staging",
+			}
+		}
+
+		It("should format, open and create the filesystem on the mapped device", func() {
+			var fsDevice string
+			underTest.fsMaker = fsMakerFunc(func(device, fsType string, options []string) error {
+				fsDevice = device
+				return nil
+			})
+			res, err := underTest.NodeStageVolume(context.TODO(), newEncryptedStageRequest())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).ToNot(BeNil())
+			Expect(encryptor.formatted).To(BeTrue())
+			Expect(encryptor.open).To(BeTrue())
+			Expect(fsDevice).To(Equal("/dev/mapper/luks-pvc-123"))
+		})
+
+		It("should name the mapping after the volume in another infra namespace", func() {
+			var fsDevice string
+			underTest.fsMaker = fsMakerFunc(func(device, fsType string, options []string) error {
+				fsDevice = device
+				return nil
+			})
+			req := newEncryptedStageRequest()
+			req.VolumeId = "tenant-vms/pvc-123"
+			_, err := underTest.NodeStageVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fsDevice).To(Equal("/dev/mapper/luks-pvc-123"))
+		})
+
+		It("should fail without a passphrase", func() {
+			req := newEncryptedStageRequest()
+			req.Secrets = nil
+			_, err := underTest.NodeStageVolume(context.TODO(), req)
+			Expect(err).To(HaveOccurred())
+			Expect(encryptor.formatted).To(BeFalse())
+		})
+
+		It("should refuse a device that already holds a plain filesystem", func() {
+			underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
+				return []byte(fmt.Sprintf("{\"blockdevices\": [{\"serial\":\"%s\", \"path\":\"/dev/sdc\", \"fstype\":\"ext4\"}]}", serialID)), nil
+			})
+			_, err := underTest.NodeStageVolume(context.TODO(), newEncryptedStageRequest())
+			Expect(err).To(HaveOccurred())
+			Expect(encryptor.formatted).To(BeFalse())
+		})
+
+		It("should close the mapping on unstage", func() {
+			encryptor.open = true
+			res, err := underTest.NodeUnstageVolume(context.TODO(), &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "pvc-123",
+				StagingTargetPath: "/invalid/staging",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).ToNot(BeNil())
+			Expect(encryptor.open).To(BeFalse())
+		})
+	})
+
+	Context("Publishing a volume", func() {
+		It("should fail with non-matching serial ID", func() {
+			res, err := underTest.NodePublishVolume(context.TODO(), &csi.NodePublishVolumeRequest{
+				VolumeId:      "pvc-123",
+				VolumeContext: map[string]string{serialParameter: "serial000"},
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(res).To(BeNil())
+		})
+
+		It("should fail with failing mkdir", func() {
+			underTest.dirMaker = dirMakerFunc(func(s string, mode os.FileMode) error {
+				return fmt.Errorf("fail to create path s")
+			})
+
+			res, err := underTest.NodePublishVolume(context.TODO(), newPublishRequest())
+			Expect(err).To(HaveOccurred())
+			Expect(res).To(BeNil())
+		})
+
+		It("should fail with matching serial ID and failing mount", func() {
+			underTest.mounter = &failingMounter{}
+			res, err := underTest.NodePublishVolume(context.TODO(), newPublishRequest())
+			Expect(err).To(HaveOccurred())
+			Expect(res).To(BeNil())
+		})
+
+		It("should succeed, with matching serial ID and successful mount", func() {
+			res, err := underTest.NodePublishVolume(context.TODO(), newPublishRequest())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).ToNot(BeNil())
+		})
+
+		It("should bind mount the staging path", func() {
+			mounter := &successfulMounter{mounts: map[string]string{"/staging/path": "/dev/sdc"}}
+			underTest.mounter = mounter
+			underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
+				return nil, fmt.Errorf("the device of a staged volume is not needed")
+			})
+			res, err := underTest.NodePublishVolume(context.TODO(), newPublishRequest())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).ToNot(BeNil())
+			Expect(mounter.mounts).To(HaveKeyWithValue("/target/path", "/staging/path"))
+		})
+
+		It("should bind mount the staging path with the mount flags", func() {
+			mounter := &successfulMounter{mounts: map[string]string{"/staging/path": "/dev/sdc"}}
+			underTest.mounter = mounter
+			req := newPublishRequest()
+			req.VolumeCapability.GetMount().MountFlags = []string{"ro", "noexec"}
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.options["/target/path"]).To(Equal([]string{"bind", "ro", "noexec"}))
+		})
+
+		It("should remount the target path in place when it lacks mount flags", func() {
+			mounter := &successfulMounter{
+				mounts:  map[string]string{"/staging/path": "/dev/sdc", "/target/path": "/staging/path"},
+				options: map[string][]string{"/target/path": {"rw", "relatime"}},
+			}
+			underTest.mounter = mounter
+			req := newPublishRequest()
+			req.VolumeCapability.GetMount().MountFlags = []string{"noexec"}
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.unmounted).To(BeEmpty())
+			Expect(mounter.remounted).To(Equal([]string{"/target/path"}))
+			Expect(mounter.options["/target/path"]).To(Equal([]string{"bind", "noexec"}))
+		})
+
+		It("should not remount the target path for the options the kernel adds or leaves out", func() {
+			mounter := &successfulMounter{
+				mounts: map[string]string{"/staging/path": "/dev/sdc", "/target/path": "/staging/path"},
+				options: map[string][]string{
+					"/staging/path": {"rw", "seclabel", "relatime", "attr2", "inode64", "logbufs=8", "noquota"},
+					"/target/path":  {"rw", "nodev", "noexec", "seclabel", "relatime", "user_xattr", "acl", "data=ordered"},
+				},
+			}
+			underTest.mounter = mounter
+			req := newPublishRequest()
+			req.VolumeCapability.GetMount().MountFlags = []string{"defaults", "noexec", "async", "nodev", "nofail"}
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.unmounted).To(BeEmpty())
+			Expect(mounter.remounted).To(BeEmpty())
+		})
+
+		It("should remount the target path when a default flag is turned off", func() {
+			mounter := &successfulMounter{
+				mounts:  map[string]string{"/staging/path": "/dev/sdc", "/target/path": "/staging/path"},
+				options: map[string][]string{"/target/path": {"rw", "noexec", "relatime"}},
+			}
+			underTest.mounter = mounter
+			req := newPublishRequest()
+			req.VolumeCapability.GetMount().MountFlags = []string{"exec"}
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.remounted).To(Equal([]string{"/target/path"}))
+		})
+
+		It("should leave the target path mounted when it has the mount flags", func() {
+			mounter := &successfulMounter{
+				mounts:  map[string]string{"/staging/path": "/dev/sdc", "/target/path": "/staging/path"},
+				options: map[string][]string{"/target/path": {"rw", "noexec"}},
+			}
+			underTest.mounter = mounter
+			req := newPublishRequest()
+			req.VolumeCapability.GetMount().MountFlags = []string{"noexec"}
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.unmounted).To(BeEmpty())
+		})
+
+		It("should mount the target path read only", func() {
+			mounter := &successfulMounter{mounts: map[string]string{"/staging/path": "/dev/sdc"}}
+			underTest.mounter = mounter
+			req := newPublishRequest()
+			req.Readonly = true
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.options["/target/path"]).To(Equal([]string{"bind", "ro"}))
+			Expect(mounter.options["/staging/path"]).To(BeNil())
 		})
 
-		It("should fail with failing mkdir", func() {
-			underTest.dirMaker = dirMakerFunc(func(s string, mode os.FileMode) error {
-				return fmt.Errorf("fail to create path s")
-			})
+		It("should mount the target path again when it binds another device", func() {
+			mounter := &successfulMounter{
+				mounts:  map[string]string{"/staging/path": "/dev/sdc", "/target/path": "/dev/sdb"},
+				options: map[string][]string{"/target/path": {"rw"}},
+			}
+			underTest.mounter = mounter
+			_, err := underTest.NodePublishVolume(context.TODO(), newPublishRequest())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.unmounted).To(Equal([]string{"/target/path"}))
+			Expect(mounter.mounts).To(HaveKeyWithValue("/target/path", "/staging/path"))
+		})
 
-			res, err := underTest.NodePublishVolume(context.TODO(), newPublishRequest())
-			Expect(err).To(HaveOccurred())
-			Expect(res).To(BeNil())
+		DescribeTable("should refuse a target path mounted with another read only mode", func(options []string, readOnly bool) {
+			mounter := &successfulMounter{
+				mounts:  map[string]string{"/staging/path": "/dev/sdc", "/target/path": "/staging/path"},
+				options: map[string][]string{"/target/path": options},
+			}
+			underTest.mounter = mounter
+			req := newPublishRequest()
+			req.Readonly = readOnly
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
+			Expect(status.Code(err)).To(Equal(codes.AlreadyExists))
+			Expect(mounter.unmounted).To(BeEmpty())
+		},
+			Entry("read write mount of a read only request", []string{"rw"}, true),
+			Entry("read only mount of a read write request", []string{"ro"}, false),
+		)
+
+		It("should refuse a volume staged from another device", func() {
+			mounter := &successfulMounter{
+				mounts:  map[string]string{"/staging/path": "/dev/sdb", "/target/path": "/staging/path"},
+				options: map[string][]string{"/target/path": {"rw"}},
+			}
+			underTest.mounter = mounter
+			_, err := underTest.NodePublishVolume(context.TODO(), newPublishRequest())
+			Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+			Expect(err.Error()).To(ContainSubstring("staged from device /dev/sdb, but its disk is /dev/sdc"))
+			Expect(mounter.unmounted).To(BeEmpty())
 		})
 
-		It("should fail with matching serial ID and failing mount", func() {
-			underTest.mounter = &failingMounter{}
-			res, err := underTest.NodePublishVolume(context.TODO(), newPublishRequest())
-			Expect(err).To(HaveOccurred())
-			Expect(res).To(BeNil())
+		It("should bind mount the device of block volumes again when the target is another device", func() {
+			req := newPublishRequest()
+			req.TargetPath = filepath.Join(GinkgoT().TempDir(), "block")
+			Expect(os.WriteFile(req.TargetPath, nil, 0640)).To(Succeed())
+			req.StagingTargetPath = ""
+			req.VolumeCapability = &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Block{
+					Block: &csi.VolumeCapability_BlockVolume{},
+				},
+			}
+			mounter := &successfulMounter{mounts: map[string]string{req.TargetPath: "udev"}}
+			underTest.mounter = mounter
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.unmounted).To(Equal([]string{req.TargetPath}))
+			Expect(mounter.mounts).To(HaveKeyWithValue(req.TargetPath, "/dev/sdc"))
 		})
 
-		It("should succeed, with matching serial ID and successful mount", func() {
-			res, err := underTest.NodePublishVolume(context.TODO(), newPublishRequest())
+		It("should leave the target of block volumes mounted when it is the device", func() {
+			// Tests can't create block devices, a character device stands in for the disk.
+			underTest.deviceLister = deviceListerFunc(func() ([]byte, error) {
+				return []byte(fmt.Sprintf(`{"blockdevices": [{"serial":"%s", "name":"null", "fstype":null}]}`, serialID)), nil
+			})
+			req := newPublishRequest()
+			req.TargetPath = "/dev/null"
+			req.StagingTargetPath = ""
+			req.VolumeCapability = &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Block{
+					Block: &csi.VolumeCapability_BlockVolume{},
+				},
+			}
+			mounter := &successfulMounter{mounts: map[string]string{"/dev/null": "udev"}}
+			underTest.mounter = mounter
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(res).ToNot(BeNil())
+			Expect(mounter.unmounted).To(BeEmpty())
 		})
 
-		It("should perform a resize when it's required", func() {
+		It("should mount the staging path of volumes staged without it", func() {
 			resizer := &successfulResizer{}
 			underTest.resizer = resizer
+			mounter := &successfulMounter{}
+			underTest.mounter = mounter
 			res, err := underTest.NodePublishVolume(context.TODO(), newPublishRequest())
 			Expect(err).ToNot(HaveOccurred())
 			Expect(res).ToNot(BeNil())
+			Expect(mounter.mounts).To(HaveKeyWithValue("/staging/path", "/dev/sdc"))
+			Expect(mounter.mounts).To(HaveKeyWithValue("/target/path", "/staging/path"))
 			Expect(resizer.resizeOccured).To(BeTrue())
 		})
 
-		It("should continue to resize call despite mount existing", func() {
-			// Simulates a retry of NodePublishVolume following an error during resize
+		It("should mount the staging path of volumes staged without it with discard", func() {
 			underTest.resizer = &successfulResizer{}
-			// Simulate a mount already existing since it was performed
-			// in the first iteration
-			underTest.mounter = &noopMounter{}
-			res, err := underTest.NodePublishVolume(context.TODO(), newPublishRequest())
+			mounter := &successfulMounter{}
+			underTest.mounter = mounter
+			req := newPublishRequest()
+			req.VolumeContext[discardParameter] = discardOnline
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(res).ToNot(BeNil())
-			Expect(underTest.mounter.(*noopMounter).mountOccured).To(BeFalse())
-			Expect(underTest.resizer.(*successfulResizer).resizeOccured).To(BeTrue())
+			Expect(mounter.options["/staging/path"]).To(ContainElement("discard"))
+		})
+
+		It("should bind mount the device of block volumes", func() {
+			mounter := &successfulMounter{}
+			underTest.mounter = mounter
+			req := newPublishRequest()
+			req.TargetPath = filepath.Join(GinkgoT().TempDir(), "block")
+			req.StagingTargetPath = ""
+			req.VolumeCapability = &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Block{
+					Block: &csi.VolumeCapability_BlockVolume{},
+				},
+			}
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.mounts).To(Equal(map[string]string{req.TargetPath: "/dev/sdc"}))
+		})
+
+		It("should require the staging path of filesystem volumes", func() {
+			req := newPublishRequest()
+			req.StagingTargetPath = ""
+			_, err := underTest.NodePublishVolume(context.TODO(), req)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		})
+	})
+
+	Context("Un-Staging a volume", func() {
+		It("should unmount the staging path", func() {
+			mounter := &successfulMounter{mounts: map[string]string{"/staging/path": "/dev/sdc"}}
+			underTest.mounter = mounter
+			_, err := underTest.NodeUnstageVolume(context.TODO(), &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "pvc-123",
+				StagingTargetPath: "/staging/path",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.unmounted).To(Equal([]string{"/staging/path"}))
+		})
+
+		It("should succeed when the staging path isn't mounted", func() {
+			mounter := &successfulMounter{}
+			underTest.mounter = mounter
+			_, err := underTest.NodeUnstageVolume(context.TODO(), &csi.NodeUnstageVolumeRequest{
+				VolumeId:          "pvc-123",
+				StagingTargetPath: "/staging/path",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(mounter.unmounted).To(BeEmpty())
 		})
 	})
 
@@ -248,6 +1191,109 @@ var _ = Describe("NodeService", func() {
 			Expect(resizer.resizeOccured).To(BeTrue())
 		})
 
+		It("should resize the LUKS mapping of an encrypted volume", func() {
+			encryptor := &fakeEncryptor{}
+			underTest.encryptor = encryptor
+			underTest.resizer = &successfulResizer{}
+			underTest.devicePathGetter = devicePathGetterFunc(func(mountPath string) (string, error) {
+				return "/dev/mapper/luks-pvc-123", nil
+			})
+			_, err := underTest.NodeExpandVolume(context.TODO(),
+				&csi.NodeExpandVolumeRequest{
+					VolumeId: "pvc-123",
+					VolumeCapability: &csi.VolumeCapability{
+						AccessType: &csi.VolumeCapability_Mount{
+							Mount: &csi.VolumeCapability_MountVolume{
+								FsType: "ext4",
+							},
+						},
+					},
+					VolumePath: "/target/path",
+					Secrets:    map[string]string{encryptionPassphraseKey: "secret"},
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encryptor.resized).To(Equal("luks-pvc-123"))
+		})
+
+		Context("with a disk that grows", func() {
+			var (
+				sizer   *fakeDeviceSizer
+				request *csi.NodeExpandVolumeRequest
+			)
+
+			BeforeEach(func() {
+				sizer = &fakeDeviceSizer{sizes: map[string][]int64{"/dev/sdc": {1 << 30, 2 << 30}}}
+				underTest.deviceSizer = sizer
+				underTest.resizer = &successfulResizer{}
+				underTest.stateStore = &fileStateStore{dir: GinkgoT().TempDir()}
+				Expect(underTest.stateStore.Save(VolumeState{VolumeID: "pvc-123", StagingPath: "/staging/path", Serial: serialID})).To(Succeed())
+				request = &csi.NodeExpandVolumeRequest{
+					VolumeId: "pvc-123",
+					VolumeCapability: &csi.VolumeCapability{
+						AccessType: &csi.VolumeCapability_Block{
+							Block: &csi.VolumeCapability_BlockVolume{},
+						},
+					},
+					VolumePath:    "/target/path",
+					CapacityRange: &csi.CapacityRange{RequiredBytes: 2 << 30},
+				}
+			})
+
+			It("should rescan the disk of a block volume until it grows", func() {
+				underTest.deviceWaitTimeout = 5 * time.Second
+				res, err := underTest.NodeExpandVolume(context.TODO(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(res.GetCapacityBytes()).To(Equal(int64(2 << 30)))
+				Expect(sizer.rescanned).To(Equal([]string{"/dev/sdc", "/dev/sdc"}))
+			})
+
+			It("should return Unavailable when the disk doesn't grow in time", func() {
+				_, err := underTest.NodeExpandVolume(context.TODO(), request)
+				Expect(status.Code(err)).To(Equal(codes.Unavailable))
+				Expect(err.Error()).To(ContainSubstring("hasn't grown to 2147483648 bytes"))
+			})
+
+			It("should fail when the size of the disk can't be read", func() {
+				sizer.sizes = nil
+				_, err := underTest.NodeExpandVolume(context.TODO(), request)
+				Expect(status.Code(err)).To(Equal(codes.Internal))
+			})
+
+			It("should resize the LUKS mapping of an encrypted block volume", func() {
+				sizer.sizes["/dev/sdc"] = []int64{2 << 30}
+				sizer.sizes["/dev/mapper/luks-pvc-123"] = []int64{2<<30 - 16<<20}
+				encryptor := &fakeEncryptor{open: true}
+				underTest.encryptor = encryptor
+				request.Secrets = map[string]string{encryptionPassphraseKey: "secret"}
+				res, err := underTest.NodeExpandVolume(context.TODO(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(encryptor.resized).To(Equal("luks-pvc-123"))
+				Expect(sizer.rescanned).To(Equal([]string{"/dev/sdc"}))
+				Expect(res.GetCapacityBytes()).To(Equal(int64(2<<30 - 16<<20)))
+			})
+
+			It("should report the size of the LUKS mapping of an encrypted volume", func() {
+				sizer.sizes["/dev/sdc"] = []int64{2 << 30}
+				sizer.sizes["/dev/mapper/luks-pvc-123"] = []int64{2<<30 - 16<<20}
+				encryptor := &fakeEncryptor{}
+				underTest.encryptor = encryptor
+				underTest.devicePathGetter = devicePathGetterFunc(func(mountPath string) (string, error) {
+					return "/dev/mapper/luks-pvc-123", nil
+				})
+				request.VolumeCapability = &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{
+						Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"},
+					},
+				}
+				res, err := underTest.NodeExpandVolume(context.TODO(), request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(encryptor.resized).To(Equal("luks-pvc-123"))
+				Expect(sizer.rescanned).To(Equal([]string{"/dev/sdc"}))
+				Expect(res.GetCapacityBytes()).To(Equal(int64(2<<30 - 16<<20)))
+			})
+		})
+
 		It("should not resize block volume", func() {
 			resizer := &successfulResizer{}
 			underTest.resizer = resizer
@@ -312,6 +1358,63 @@ var _ = Describe("NodeService", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(res).ToNot(BeNil())
 		})
+
+		It("should report the condition of the volume", func() {
+			tmpDir := GinkgoT().TempDir()
+			underTest.mounter = &successfulMounter{}
+			underTest.volumeConditionChecker = &fakeConditionChecker{condition: &csi.VolumeCondition{Abnormal: true, Message: "device sdc of the volume has disappeared"}}
+			res, err := underTest.NodeGetVolumeStats(context.TODO(),
+				&csi.NodeGetVolumeStatsRequest{
+					VolumeId:   "pvc-123",
+					VolumePath: tmpDir,
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.GetUsage()).To(HaveLen(2))
+			Expect(res.GetVolumeCondition().GetAbnormal()).To(BeTrue())
+		})
+
+		It("should report the condition of a broken volume without usage", func() {
+			tmpDir := GinkgoT().TempDir()
+			underTest.mounter = &failingMounter{}
+			underTest.volumeConditionChecker = &fakeConditionChecker{condition: &csi.VolumeCondition{Abnormal: true, Message: "filesystem on /dev/sdc was remounted read only"}}
+			res, err := underTest.NodeGetVolumeStats(context.TODO(),
+				&csi.NodeGetVolumeStatsRequest{
+					VolumeId:   "pvc-123",
+					VolumePath: tmpDir,
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.GetUsage()).To(BeEmpty())
+			Expect(res.GetVolumeCondition().GetMessage()).To(ContainSubstring("read only"))
+		})
+
+		It("should fail when the usage of a healthy volume is unknown", func() {
+			tmpDir := GinkgoT().TempDir()
+			underTest.mounter = &failingMounter{}
+			underTest.volumeConditionChecker = &fakeConditionChecker{condition: healthyVolume()}
+			_, err := underTest.NodeGetVolumeStats(context.TODO(),
+				&csi.NodeGetVolumeStatsRequest{
+					VolumeId:   "pvc-123",
+					VolumePath: tmpDir,
+				},
+			)
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+		})
+	})
+	Context("Node info", func() {
+		It("should report the node ID and the attach limit", func() {
+			underTest.maxVolumesPerNode = 14
+			res, err := underTest.NodeGetInfo(context.TODO(), &csi.NodeGetInfoRequest{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.GetNodeId()).To(Equal("vm-worker-0-0"))
+			Expect(res.GetMaxVolumesPerNode()).To(Equal(int64(14)))
+		})
+
+		It("should default the attach limit to the smallest limit of the buses", func() {
+			Expect(NewNodeService("ns/vm", 0, nil).maxVolumesPerNode).To(Equal(int64(14)))
+			Expect(NewNodeService("ns/vm", 40, nil).maxVolumesPerNode).To(Equal(int64(40)))
+		})
 	})
 })
 
@@ -328,18 +1431,176 @@ var _ = Describe("makeFS", func() {
 	})
 
 	It("should return error when mkfs binary is not found", func() {
-		err := makeFS("/dev/fake", "ext4")
+		err := makeFS("/dev/fake", "ext4", nil)
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("executable file not found"))
 	})
 
 	It("should return error for unsupported filesystem type", func() {
-		err := makeFS("/dev/fake", "ntfs")
+		err := makeFS("/dev/fake", "ntfs", nil)
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("not supported"))
 	})
 })
 
+// fakeCommand is the result of a command run by a fake executor.
+type fakeCommand struct {
+	output     string
+	exitStatus int
+}
+
+// newFakeExec returns an executor that answers the commands it runs with results, in order, and records their
+// command lines in commands.
+func newFakeExec(commands *[]string, results ...fakeCommand) *testingexec.FakeExec {
+	fake := &testingexec.FakeExec{}
+	for _, result := range results {
+		fake.CommandScript = append(fake.CommandScript, func(cmd string, args ...string) utilexec.Cmd {
+			*commands = append(*commands, strings.Join(append([]string{cmd}, args...), " "))
+			return testingexec.InitFakeCmd(&testingexec.FakeCmd{
+				CombinedOutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) {
+					if result.exitStatus != 0 {
+						return []byte(result.output), nil, testingexec.FakeExitError{Status: result.exitStatus}
+					}
+					return []byte(result.output), nil, nil
+				}},
+			}, cmd, args...)
+		})
+	}
+	return fake
+}
+
+var _ = Describe("fsChecker", func() {
+	var commands []string
+
+	BeforeEach(func() {
+		commands = nil
+	})
+
+	DescribeTable("should run the check tool of the filesystem", func(fsType string, repair bool, results []fakeCommand, expected []string, expectedErr string) {
+		checker := &fsChecker{exec: newFakeExec(&commands, results...)}
+		_, err := checker.Check("/dev/fake", fsType, repair)
+		if expectedErr != "" {
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		} else {
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(commands).To(Equal(expected))
+	},
+		// A read-only check can't replay the journal, and reports a filesystem whose journal needs recovery as corrupt.
+		Entry("ext4 check replays the journal first", "ext4", false, []fakeCommand{{exitStatus: 1}, {}},
+			[]string{"e2fsck -p -E journal_only /dev/fake", "e2fsck -f -n /dev/fake"}, ""),
+		Entry("ext4 repair", "ext4", true, []fakeCommand{{}},
+			[]string{"e2fsck -f -p /dev/fake"}, ""),
+		Entry("ext4 repair that corrected errors", "ext3", true, []fakeCommand{{exitStatus: 1}},
+			[]string{"e2fsck -f -p /dev/fake"}, ""),
+		Entry("corrupt ext4", "ext4", false, []fakeCommand{{}, {output: "Inode 12 has illegal blocks.", exitStatus: 4}},
+			[]string{"e2fsck -p -E journal_only /dev/fake", "e2fsck -f -n /dev/fake"}, "e2fsck failed"),
+		Entry("ext4 whose journal can't be replayed", "ext4", false, []fakeCommand{{exitStatus: 8}},
+			[]string{"e2fsck -p -E journal_only /dev/fake"}, "failed to replay the journal"),
+		Entry("xfs check", "xfs", false, []fakeCommand{{}},
+			[]string{"xfs_repair -n /dev/fake"}, ""),
+		Entry("xfs with a dirty log", "xfs", false, []fakeCommand{{exitStatus: 2}},
+			[]string{"xfs_repair -n /dev/fake"}, ""),
+		Entry("xfs repair", "xfs", true, []fakeCommand{{}},
+			[]string{"xfs_repair /dev/fake"}, ""),
+		Entry("corrupt xfs", "xfs", false, []fakeCommand{{exitStatus: 1}},
+			[]string{"xfs_repair -n /dev/fake"}, "xfs_repair failed"),
+		Entry("btrfs is only checked", "btrfs", true, []fakeCommand{{}},
+			[]string{"btrfs check --readonly /dev/fake"}, ""),
+		Entry("corrupt btrfs", "btrfs", false, []fakeCommand{{exitStatus: 1}},
+			[]string{"btrfs check --readonly /dev/fake"}, "btrfs failed"),
+	)
+
+	It("should return the output of the check", func() {
+		checker := &fsChecker{exec: newFakeExec(&commands, fakeCommand{output: "Phase 1 - find and verify superblock...\n"})}
+		output, err := checker.Check("/dev/fake", "xfs", false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(output).To(Equal("Phase 1 - find and verify superblock..."))
+	})
+
+	It("should not check filesystems it has no tool for", func() {
+		checker := &fsChecker{exec: newFakeExec(&commands)}
+		_, err := checker.Check("/dev/fake", "vfat", true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(commands).To(BeEmpty())
+	})
+})
+
+var _ = Describe("fsUUIDChanger", func() {
+	var commands []string
+
+	newChanger := func(results ...fakeCommand) *fsUUIDChanger {
+		exec := newFakeExec(&commands, results...)
+		return &fsUUIDChanger{exec: exec, checker: &fsChecker{exec: exec}}
+	}
+
+	BeforeEach(func() {
+		commands = nil
+	})
+
+	It("should check an ext filesystem before it changes its UUID", func() {
+		Expect(newChanger(fakeCommand{exitStatus: 1}, fakeCommand{}).SetUUID("/dev/fake", "ext4", serialID)).To(Succeed())
+		Expect(commands).To(Equal([]string{"e2fsck -f -p /dev/fake", "tune2fs -U " + serialID + " /dev/fake"}))
+	})
+
+	It("should not change the UUID of an ext filesystem that fails the check", func() {
+		err := newChanger(fakeCommand{output: "UNEXPECTED INCONSISTENCY; RUN fsck MANUALLY.", exitStatus: 4}).SetUUID("/dev/fake", "ext4", serialID)
+		Expect(err).To(MatchError(ContainSubstring("e2fsck failed")))
+		Expect(err).To(MatchError(ContainSubstring("RUN fsck MANUALLY")))
+		Expect(commands).To(Equal([]string{"e2fsck -f -p /dev/fake"}))
+	})
+
+	It("should report why tune2fs refused to change the UUID", func() {
+		err := newChanger(fakeCommand{}, fakeCommand{output: "This operation requires a freshly checked filesystem.", exitStatus: 1}).SetUUID("/dev/fake", "ext4", serialID)
+		Expect(err).To(MatchError(ContainSubstring("tune2fs failed")))
+		Expect(err).To(MatchError(ContainSubstring("requires a freshly checked filesystem")))
+	})
+
+	It("should change the UUID of an xfs filesystem without checking it", func() {
+		Expect(newChanger(fakeCommand{}).SetUUID("/dev/fake", "xfs", serialID)).To(Succeed())
+		Expect(commands).To(Equal([]string{"xfs_admin -U " + serialID + " /dev/fake"}))
+	})
+})
+
+var _ = Describe("parseMkfsOptions", func() {
+	DescribeTable("should validate the options of the filesystem", func(fsType, options string, expected []string, expectedErr string) {
+		args, err := parseMkfsOptions(fsType, options)
+		if expectedErr != "" {
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			return
+		}
+		Expect(err).ToNot(HaveOccurred())
+		Expect(args).To(Equal(expected))
+	},
+		Entry("no options", "ext4", "", []string{}, ""),
+		Entry("ext4 inode ratio and lazy init", "ext4", "-i 16384 -E lazy_itable_init=0,lazy_journal_init=0", []string{"-i", "16384", "-E", "lazy_itable_init=0,lazy_journal_init=0"}, ""),
+		Entry("ext3 journal", "ext3", "-j -b 4096", []string{"-j", "-b", "4096"}, ""),
+		Entry("xfs reflink", "xfs", "-m reflink=1", []string{"-m", "reflink=1"}, ""),
+		Entry("btrfs features", "btrfs", "-O ^no-holes -n 16384", []string{"-O", "^no-holes", "-n", "16384"}, ""),
+		Entry("unsupported filesystem", "ntfs", "", nil, "not supported"),
+		Entry("option that isn't allowed", "ext4", "-F", nil, "not allowed"),
+		Entry("option of another filesystem", "btrfs", "-E lazy_itable_init=0", nil, "not allowed"),
+		Entry("missing value", "xfs", "-m", nil, "requires a valid value"),
+		Entry("option as value", "ext4", "-L -F", nil, "requires a valid value"),
+		Entry("path as value", "ext4", "-L /dev/sda", nil, "requires a valid value"),
+	)
+})
+
+func newStageRequest() *csi.NodeStageVolumeRequest {
+	return &csi.NodeStageVolumeRequest{
+		VolumeId:      "pvc-123",
+		VolumeContext: map[string]string{serialParameter: serialID},
+		VolumeCapability: &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{
+					FsType: "ext4",
+				},
+			},
+		},
+		StagingTargetPath: "/staging/path",
+	}
+}
+
 func newPublishRequest() *csi.NodePublishVolumeRequest {
 	return &csi.NodePublishVolumeRequest{
 		VolumeId:      "pvc-123",
@@ -351,8 +1612,136 @@ func newPublishRequest() *csi.NodePublishVolumeRequest {
 				},
 			},
 		},
-		TargetPath: "/target/path",
+		StagingTargetPath: "/staging/path",
+		TargetPath:        "/target/path",
+	}
+}
+
+type fakeFsChecker struct {
+	checked []string
+	repair  bool
+	err     error
+}
+
+func (c *fakeFsChecker) Check(device, fsType string, repair bool) (string, error) {
+	c.checked = append(c.checked, device)
+	c.repair = repair
+	return "clean", c.err
+}
+
+type fakeFsUUIDChanger struct {
+	uuid string
+	set  []string
+	err  error
+}
+
+func (c *fakeFsUUIDChanger) UUID(device, fsType string) (string, error) {
+	return c.uuid, nil
+}
+
+func (c *fakeFsUUIDChanger) SetUUID(device, fsType, uuid string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.set = append(c.set, device+"="+uuid)
+	c.uuid = uuid
+	return nil
+}
+
+type fakeDeviceReleaser struct {
+	holders []string
+	flushed []string
+	err     error
+}
+
+func (r *fakeDeviceReleaser) Holders(devicePath string) ([]string, error) {
+	return r.holders, nil
+}
+
+func (r *fakeDeviceReleaser) Flush(devicePath string) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.flushed = append(r.flushed, devicePath)
+	return nil
+}
+
+// fakeDeviceSizer reports the sizes of a device in turn, the last one once they are used up.
+type fakeDeviceSizer struct {
+	sizes     map[string][]int64
+	rescanned []string
+}
+
+func (s *fakeDeviceSizer) Rescan(devicePath string) error {
+	s.rescanned = append(s.rescanned, devicePath)
+	return nil
+}
+
+func (s *fakeDeviceSizer) Size(devicePath string) (int64, error) {
+	sizes := s.sizes[devicePath]
+	if len(sizes) == 0 {
+		return 0, fmt.Errorf("no size for %s", devicePath)
 	}
+	if len(sizes) > 1 {
+		s.sizes[devicePath] = sizes[1:]
+	}
+	return sizes[0], nil
+}
+
+type fakeConditionChecker struct {
+	condition *csi.VolumeCondition
+}
+
+func (c *fakeConditionChecker) Condition(volumePath string, isBlock bool) *csi.VolumeCondition {
+	return c.condition
+}
+
+type fakeEventRecorder struct {
+	events []string
+}
+
+func (r *fakeEventRecorder) Event(volumeID, eventType, reason, message string) {
+	r.events = append(r.events, fmt.Sprintf("%s %s %s: %s", volumeID, eventType, reason, message))
+}
+
+type fakeRescanner struct {
+	buses []string
+	err   error
+}
+
+func (r *fakeRescanner) Rescan(bus string) error {
+	r.buses = append(r.buses, bus)
+	return r.err
+}
+
+type fakeEncryptor struct {
+	formatted bool
+	open      bool
+	resized   string
+}
+
+func (e *fakeEncryptor) Format(devicePath, passphrase string) error {
+	e.formatted = true
+	return nil
+}
+
+func (e *fakeEncryptor) Open(devicePath, mapperName, passphrase string) error {
+	e.open = true
+	return nil
+}
+
+func (e *fakeEncryptor) Close(mapperName string) error {
+	e.open = false
+	return nil
+}
+
+func (e *fakeEncryptor) Resize(mapperName, passphrase string) error {
+	e.resized = mapperName
+	return nil
+}
+
+func (e *fakeEncryptor) IsOpen(mapperName string) (bool, error) {
+	return e.open, nil
 }
 
 type noopResizer struct{}
@@ -389,6 +1778,11 @@ func (m *noopMounter) IsLikelyNotMountPoint(file string) (bool, error) {
 type successfulMounter struct {
 	mountOccured bool
 	isBlock      bool
+	// mounts maps the mount points to their source.
+	mounts    map[string]string
+	options   map[string][]string
+	unmounted []string
+	remounted []string
 }
 
 type failingMounter struct {
@@ -420,6 +1814,14 @@ func (s *successfulMounter) GetVolumeStats(volumePath string) (mounter.VolumeSta
 
 func (m *successfulMounter) Mount(source string, target string, fstype string, options []string) error {
 	m.mountOccured = true
+	if m.mounts == nil {
+		m.mounts = map[string]string{}
+	}
+	m.mounts[target] = source
+	if m.options == nil {
+		m.options = map[string][]string{}
+	}
+	m.options[target] = options
 	return nil
 }
 
@@ -427,16 +1829,33 @@ func (m *successfulMounter) MountSensitive(source string, target string, fstype
 	return nil
 }
 
+func (m *successfulMounter) BindRemount(target string, options []string) error {
+	m.remounted = append(m.remounted, target)
+	m.options[target] = append([]string{"bind"}, options...)
+	return nil
+}
+
 func (m *successfulMounter) Unmount(target string) error {
+	delete(m.mounts, target)
+	m.unmounted = append(m.unmounted, target)
 	return nil
 }
 
 func (m *successfulMounter) List() ([]mount.MountPoint, error) {
-	panic("implement me")
+	var mountPoints []mount.MountPoint
+	for target, source := range m.mounts {
+		// Like the kernel, report the device of a bind mount of another mount.
+		if device, ok := m.mounts[source]; ok {
+			source = device
+		}
+		mountPoints = append(mountPoints, mount.MountPoint{Device: source, Path: target, Opts: m.options[target]})
+	}
+	return mountPoints, nil
 }
 
 func (m *successfulMounter) IsLikelyNotMountPoint(file string) (bool, error) {
-	return true, nil
+	_, mounted := m.mounts[file]
+	return !mounted, nil
 }
 
 func (m *successfulMounter) GetMountRefs(pathname string) ([]string, error) {
@@ -463,6 +1882,10 @@ func (f *failingMounter) Mount(source string, target string, fstype string, opti
 	return fmt.Errorf("failing mounter always fails")
 }
 
+func (f *failingMounter) GetVolumeStats(volumePath string) (mounter.VolumeStats, error) {
+	return mounter.VolumeStats{}, fmt.Errorf("failing mounter always fails")
+}
+
 func (f *failingMounter) Unmount(target string) error {
 	return fmt.Errorf("failing unmounter always fails")
 }
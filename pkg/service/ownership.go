@@ -0,0 +1,45 @@
+package service
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VMOwnership configures how the controller recognises the infra VMs of the tenant cluster, so volumes are never
+// hot-plugged into the VM of another tenant that shares the infra namespace.
+type VMOwnership struct {
+	// Enforce rejects attaching volumes to VMs that carry neither the infra cluster labels nor the annotation.
+	Enforce bool
+	// AnnotationKey and AnnotationValue mark the VMs of the tenant cluster when they can't carry the labels.
+	AnnotationKey   string
+	AnnotationValue string
+}
+
+// checkVMOwnership returns PermissionDenied when the VM or VMI doesn't belong to this tenant cluster.
+func (c *ControllerService) checkVMOwnership(vm metav1.Object) error {
+	if !c.vmOwnership.Enforce || c.ownsVM(vm) {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "VM %s/%s does not belong to this tenant cluster", vm.GetNamespace(), vm.GetName())
+}
+
+func (c *ControllerService) ownsVM(vm metav1.Object) bool {
+	if key := c.vmOwnership.AnnotationKey; key != "" {
+		if value, ok := vm.GetAnnotations()[key]; ok && value == c.vmOwnership.AnnotationValue {
+			return true
+		}
+	}
+	if len(c.infraClusterLabels) == 0 {
+		// Without labels every VM matches, like the DataVolumes in containsLabels, unless the annotation marks the
+		// VMs of the tenant cluster.
+		return c.vmOwnership.AnnotationKey == ""
+	}
+	labels := vm.GetLabels()
+	for key, value := range c.infraClusterLabels {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
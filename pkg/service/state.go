@@ -0,0 +1,140 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	klog "k8s.io/klog/v2"
+)
+
+// DefaultStateDir is where the node plugin keeps the state of staged volumes, on the host so it outlives restarts of
+// the node plugin.
+const DefaultStateDir = "/var/lib/kubelet/plugins/csi.kubevirt.io/volumes"
+
+// VolumeState is what the node remembers about a staged volume, to find its device when it is unstaged and to trim
+// its filesystem periodically.
+type VolumeState struct {
+	VolumeID    string `json:"volumeID"`
+	StagingPath string `json:"stagingPath"`
+	Serial      string `json:"serial,omitempty"`
+	Discard     string `json:"discard,omitempty"`
+}
+
+// VolumeStateStore keeps the state of the volumes staged on the node.
+type VolumeStateStore interface {
+	Save(state VolumeState) error
+	Get(volumeID string) (VolumeState, bool, error)
+	Delete(volumeID string) error
+	List() ([]VolumeState, error)
+}
+
+var NewVolumeStateStore = func() VolumeStateStore {
+	return &fileStateStore{dir: DefaultStateDir}
+}
+
+// fileStateStore keeps the state of every volume in a JSON file named after the volume.
+type fileStateStore struct {
+	dir string
+}
+
+func (s *fileStateStore) path(volumeID string) string {
+	return filepath.Join(s.dir, volumeName(volumeID)+".json")
+}
+
+func (s *fileStateStore) Save(state VolumeState) error {
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// Write and rename, so a crash never leaves a truncated file behind.
+	tmp, err := os.CreateTemp(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(state.VolumeID))
+}
+
+func (s *fileStateStore) Get(volumeID string) (VolumeState, bool, error) {
+	data, err := os.ReadFile(s.path(volumeID))
+	if errors.Is(err, os.ErrNotExist) {
+		return VolumeState{}, false, nil
+	} else if err != nil {
+		return VolumeState{}, false, err
+	}
+	var state VolumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return VolumeState{}, false, fmt.Errorf("invalid volume state of %s: %w", volumeID, err)
+	}
+	return state, true, nil
+}
+
+func (s *fileStateStore) Delete(volumeID string) error {
+	if err := os.Remove(s.path(volumeID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *fileStateStore) List() ([]VolumeState, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var states []VolumeState
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		// A state file that can't be read only loses its own volume, the other volumes are still trimmed.
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			klog.Errorf("Skipping volume state %s: %v", entry.Name(), err)
+			continue
+		}
+		var state VolumeState
+		if err := json.Unmarshal(data, &state); err != nil {
+			klog.Errorf("Skipping invalid volume state %s: %v", entry.Name(), err)
+			continue
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// saveVolumeState remembers the staged volume, so NodeUnstageVolume finds its device and the node trims its filesystem
+// if its discard mode is fstrim.
+func (n *NodeService) saveVolumeState(req *csi.NodeStageVolumeRequest, discard string) error {
+	if n.stateStore == nil {
+		return nil
+	}
+	state := VolumeState{
+		VolumeID:    req.GetVolumeId(),
+		StagingPath: req.GetStagingTargetPath(),
+		Serial:      req.GetVolumeContext()[serialParameter],
+		Discard:     discard,
+	}
+	if err := n.stateStore.Save(state); err != nil {
+		return status.Errorf(codes.Internal, "failed to save the state of volume %s: %v", req.GetVolumeId(), err)
+	}
+	return nil
+}
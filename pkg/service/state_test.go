@@ -0,0 +1,42 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("fileStateStore", func() {
+	It("should save, list and delete the state of volumes", func() {
+		store := &fileStateStore{dir: GinkgoT().TempDir() + "/volumes"}
+		Expect(store.List()).To(BeEmpty())
+
+		state := VolumeState{VolumeID: "pvc-123", StagingPath: "/staging/path", Discard: discardFstrim}
+		Expect(store.Save(state)).To(Succeed())
+		Expect(store.Save(state)).To(Succeed())
+		Expect(store.List()).To(ConsistOf(state))
+
+		Expect(store.Delete("pvc-123")).To(Succeed())
+		Expect(store.Delete("pvc-123")).To(Succeed())
+		Expect(store.List()).To(BeEmpty())
+	})
+
+	It("should keep the state of volumes in other infra namespaces", func() {
+		store := &fileStateStore{dir: GinkgoT().TempDir() + "/volumes"}
+		state := VolumeState{VolumeID: "tenant-vms/pvc-123", StagingPath: "/staging/path"}
+		Expect(store.Save(state)).To(Succeed())
+		Expect(store.List()).To(ConsistOf(state))
+		Expect(store.Delete("tenant-vms/pvc-123")).To(Succeed())
+		Expect(store.List()).To(BeEmpty())
+	})
+
+	It("should skip the state files it can't read", func() {
+		store := &fileStateStore{dir: GinkgoT().TempDir() + "/volumes"}
+		state := VolumeState{VolumeID: "pvc-123", StagingPath: "/staging/path", Discard: discardFstrim}
+		Expect(store.Save(state)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(store.dir, "pvc-corrupt.json"), []byte(`{"volumeID": "pvc-`), 0600)).To(Succeed())
+		Expect(store.List()).To(ConsistOf(state))
+	})
+})
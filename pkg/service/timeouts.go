@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	DefaultHotplugTimeout       = 2 * time.Minute
+	DefaultSnapshotTimeout      = 2 * time.Minute
+	DefaultExpandTimeout        = 2 * time.Minute
+	DefaultHotplugRetrySteps    = 5
+	DefaultHotplugRetryInterval = time.Second
+	hotplugRetryCap             = 30 * time.Second
+	// DefaultDeviceWaitTimeout bounds waiting on the node for the guest kernel to process the hotplug or the expansion of
+	// a volume.
+	DefaultDeviceWaitTimeout = 30 * time.Second
+	deviceWaitInterval       = time.Second
+)
+
+// ControllerTimeouts configures how long the controller waits for the infra cluster. Zero values select the
+// defaults. Every wait is also bounded by the deadline of the gRPC request, so the timeouts of the sidecars still
+// win when they are shorter.
+type ControllerTimeouts struct {
+	// Hotplug bounds waiting for a volume to show up in, or disappear from, the VMI.
+	Hotplug time.Duration
+	// Snapshot bounds waiting for an infra VolumeSnapshot to become ready to use.
+	Snapshot time.Duration
+	// Expand bounds waiting for the infra PV to be resized.
+	Expand time.Duration
+	// HotplugRetrySteps and HotplugRetryInterval configure the exponential backoff of addvolume/removevolume calls.
+	HotplugRetrySteps    int
+	HotplugRetryInterval time.Duration
+}
+
+func (t ControllerTimeouts) hotplug() time.Duration {
+	return valueOrDefault(t.Hotplug, DefaultHotplugTimeout)
+}
+
+func (t ControllerTimeouts) snapshot() time.Duration {
+	return valueOrDefault(t.Snapshot, DefaultSnapshotTimeout)
+}
+
+func (t ControllerTimeouts) expand() time.Duration {
+	return valueOrDefault(t.Expand, DefaultExpandTimeout)
+}
+
+func (t ControllerTimeouts) hotplugBackoff() wait.Backoff {
+	steps := t.HotplugRetrySteps
+	if steps <= 0 {
+		steps = DefaultHotplugRetrySteps
+	}
+	return wait.Backoff{
+		Duration: valueOrDefault(t.HotplugRetryInterval, DefaultHotplugRetryInterval),
+		Steps:    steps,
+		Factor:   2,
+		Cap:      hotplugRetryCap,
+	}
+}
+
+func valueOrDefault(value, defaultValue time.Duration) time.Duration {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// boundedTimeout returns timeout, or what is left until the deadline of ctx if that is sooner.
+func boundedTimeout(ctx context.Context, timeout time.Duration) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < timeout {
+			return remaining
+		}
+	}
+	return timeout
+}
+
+// waitError turns a wait that timed out or ran out of retries into DeadlineExceeded, so the sidecars retry the call.
+// Other errors are returned unchanged.
+func waitError(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	if wait.Interrupted(err) {
+		return status.Errorf(codes.DeadlineExceeded, format+": %v", append(args, err)...)
+	}
+	return err
+}
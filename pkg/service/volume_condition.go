@@ -0,0 +1,229 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/sys/unix"
+	klog "k8s.io/klog/v2"
+	mount "k8s.io/mount-utils"
+)
+
+const (
+	mountInfoPath = "/proc/self/mountinfo"
+	kmsgPath      = "/dev/kmsg"
+	// deletedSuffix marks the root of a mount whose file was deleted, like the device node of an unplugged disk.
+	deletedSuffix = "//deleted"
+)
+
+// kernelErrorMessage matches the kernel messages about IO errors and filesystem corruption, for example
+// "I/O error, dev sdc, sector 2048", "Buffer I/O error on dev dm-0", "EXT4-fs error (device sdc)",
+// "XFS (sdc): Corruption detected" or "XFS (sdc): Filesystem has been shut down". Other messages merely mention
+// errors, like the mount options "errors=remount-ro" the kernel logs when it mounts an ext4 filesystem.
+var kernelErrorMessage = regexp.MustCompile(`I/O error|EXT[234]-fs error|XFS .*Corruption|Filesystem has been shut down`)
+
+// VolumeConditionChecker tells whether a published volume is healthy.
+type VolumeConditionChecker interface {
+	Condition(volumePath string, isBlock bool) *csi.VolumeCondition
+}
+
+var NewVolumeConditionChecker = func() VolumeConditionChecker {
+	return &volumeConditionChecker{mountInfoPath: mountInfoPath, devDir: devDir, kmsgPath: kmsgPath, bootTime: bootTime}
+}
+
+// volumeConditionChecker finds the device of a volume in the mountinfo of the node plugin, and reports the volume as
+// abnormal when the device has disappeared, its filesystem was remounted read only after errors, or the kernel logged
+// errors for it since its device node was created. Device names are reused, the errors of a disk or a LUKS mapping
+// that had the same name before don't count.
+type volumeConditionChecker struct {
+	mountInfoPath string
+	devDir        string
+	kmsgPath      string
+	// bootTime returns when the node booted, the kernel log is timestamped relative to it.
+	bootTime func() (time.Time, error)
+}
+
+func (c *volumeConditionChecker) Condition(volumePath string, isBlock bool) *csi.VolumeCondition {
+	mountInfos, err := mount.ParseMountInfo(c.mountInfoPath)
+	if err != nil {
+		klog.Warningf("Failed to read %s: %v", c.mountInfoPath, err)
+		return healthyVolume()
+	}
+	// Like NodeService.mountPoint, the volume is the topmost of the mounts stacked on its path.
+	var mountInfo *mount.MountInfo
+	for i := range mountInfos {
+		if mountInfos[i].MountPoint == volumePath {
+			mountInfo = &mountInfos[i]
+		}
+	}
+	if mountInfo == nil {
+		return healthyVolume()
+	}
+
+	var devicePath string
+	if isBlock {
+		// Block volumes are bind mounts of the device node, the root of the mount is its path in devtmpfs.
+		if strings.HasSuffix(mountInfo.Root, deletedSuffix) {
+			return abnormalVolume(fmt.Sprintf("device %s of the volume has disappeared", strings.TrimSuffix(mountInfo.Root, deletedSuffix)))
+		}
+		devicePath = filepath.Join(c.devDir, mountInfo.Root)
+	} else {
+		if !strings.HasPrefix(mountInfo.Source, devDir+"/") {
+			return healthyVolume()
+		}
+		devicePath = filepath.Join(c.devDir, strings.TrimPrefix(mountInfo.Source, devDir))
+		if slices.Contains(mountInfo.MountOptions, "rw") && slices.Contains(mountInfo.SuperOptions, "ro") {
+			return abnormalVolume(fmt.Sprintf("filesystem on %s was remounted read only, likely after IO errors", mountInfo.Source))
+		}
+	}
+
+	resolved, err := filepath.EvalSymlinks(devicePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return abnormalVolume(fmt.Sprintf("device %s of the volume has disappeared", devicePath))
+	} else if err != nil {
+		klog.Warningf("Failed to resolve device %s: %v", devicePath, err)
+		return healthyVolume()
+	}
+	createdAt, err := c.deviceCreatedAt(resolved)
+	if err != nil {
+		klog.Warningf("Failed to find out when device %s was created: %v", resolved, err)
+		return healthyVolume()
+	}
+	if message := c.lastKernelError(filepath.Base(resolved), createdAt); message != "" {
+		return abnormalVolume(fmt.Sprintf("kernel reported errors for device %s: %s", filepath.Base(resolved), message))
+	}
+	return healthyVolume()
+}
+
+// deviceCreatedAt returns when the device node at path was created, as time since boot like the kernel log.
+func (c *volumeConditionChecker) deviceCreatedAt(path string) (time.Duration, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return 0, err
+	}
+	booted, err := c.bootTime()
+	if err != nil {
+		return 0, err
+	}
+	return time.Unix(stat.Ctim.Unix()).Sub(booted), nil
+}
+
+// bootTime returns when the node booted, the current time minus the monotonic clock the kernel log uses.
+func bootTime() (time.Time, error) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-time.Duration(ts.Nano())), nil
+}
+
+// lastKernelError returns the last error the kernel logged for the device since since, or an empty string.
+func (c *volumeConditionChecker) lastKernelError(deviceName string, since time.Duration) string {
+	messages, err := readKernelLog(c.kmsgPath)
+	if err != nil {
+		klog.V(4).Infof("Failed to read the kernel log: %v", err)
+		return ""
+	}
+	var last string
+	for _, message := range messages {
+		if message.timestamp >= since && kernelErrorMessage.MatchString(message.text) && mentionsDevice(message.text, deviceName) {
+			last = message.text
+		}
+	}
+	return last
+}
+
+// mentionsDevice tells whether message mentions the device name on its own, not as part of a longer name like sdcd
+// or the partition sdc1.
+func mentionsDevice(message, deviceName string) bool {
+	isNameByte := func(b byte) bool {
+		return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+	}
+	for offset := 0; ; {
+		i := strings.Index(message[offset:], deviceName)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(deviceName)
+		startsName := start == 0 || !(isNameByte(message[start-1]) || message[start-1] == '-')
+		endsName := end == len(message) || !isNameByte(message[end])
+		if startsName && endsName {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+// kernelMessage is a record of the kernel log.
+type kernelMessage struct {
+	// timestamp is the time since boot the message was logged at.
+	timestamp time.Duration
+	text      string
+}
+
+// readKernelLog returns the messages in the ring buffer of the kernel. Every read of /dev/kmsg returns a record of the
+// form "priority,sequence,timestamp,flags;message", with the timestamp in microseconds, followed by continuation
+// lines that start with a space. The file is read with syscalls, since the Go runtime would wait for new records
+// instead of returning at the end of the log.
+func readKernelLog(path string) ([]kernelMessage, error) {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	var content []byte
+	buf := make([]byte, 8192)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if errors.Is(err, syscall.EPIPE) {
+			// The record was overwritten while reading, continue with the next one.
+			continue
+		}
+		if errors.Is(err, syscall.EAGAIN) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		content = append(content, buf[:n]...)
+	}
+
+	var messages []kernelMessage
+	for _, line := range strings.Split(string(content), "\n") {
+		prefix, text, ok := strings.Cut(line, ";")
+		if !ok || strings.HasPrefix(line, " ") {
+			continue
+		}
+		fields := strings.Split(prefix, ",")
+		if len(fields) < 3 {
+			continue
+		}
+		microseconds, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, kernelMessage{timestamp: time.Duration(microseconds) * time.Microsecond, text: text})
+	}
+	return messages, nil
+}
+
+func healthyVolume() *csi.VolumeCondition {
+	return &csi.VolumeCondition{Abnormal: false, Message: "volume is healthy"}
+}
+
+func abnormalVolume(message string) *csi.VolumeCondition {
+	return &csi.VolumeCondition{Abnormal: true, Message: message}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("volumeConditionChecker", func() {
+	var (
+		dir       string
+		underTest *volumeConditionChecker
+	)
+
+	writeMountInfo := func(lines ...string) {
+		Expect(os.WriteFile(underTest.mountInfoPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)).To(Succeed())
+	}
+
+	// The devices of the tests were created an hour after the node booted, the kernel log starts at the given time
+	// since boot and has a message every second.
+	const devicesCreated = time.Hour
+	writeKernelLog := func(start time.Duration, messages ...string) {
+		var records []string
+		for i, message := range messages {
+			timestamp := start + time.Duration(i)*time.Second
+			records = append(records, fmt.Sprintf("3,%d,%d,-;%s", i, timestamp.Microseconds(), message), " SUBSYSTEM=block")
+		}
+		Expect(os.WriteFile(underTest.kmsgPath, []byte(strings.Join(records, "\n")+"\n"), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		underTest = &volumeConditionChecker{
+			mountInfoPath: filepath.Join(dir, "mountinfo"),
+			devDir:        filepath.Join(dir, "dev"),
+			kmsgPath:      filepath.Join(dir, "kmsg"),
+		}
+		Expect(os.MkdirAll(underTest.devDir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(underTest.devDir, "sdc"), nil, 0644)).To(Succeed())
+		booted := time.Now().Add(-devicesCreated)
+		underTest.bootTime = func() (time.Time, error) { return booted, nil }
+		writeKernelLog(0)
+	})
+
+	It("should report a healthy filesystem volume", func() {
+		writeMountInfo("100 50 8:32 / /target rw,relatime - ext4 /dev/sdc rw")
+		Expect(underTest.Condition("/target", false).GetAbnormal()).To(BeFalse())
+	})
+
+	It("should report a healthy volume that isn't mounted", func() {
+		writeMountInfo("100 50 8:32 / /other rw,relatime - ext4 /dev/sdc rw")
+		Expect(underTest.Condition("/target", false).GetAbnormal()).To(BeFalse())
+	})
+
+	It("should report a filesystem whose device has disappeared", func() {
+		writeMountInfo("100 50 8:48 / /target rw,relatime - ext4 /dev/sdd rw")
+		condition := underTest.Condition("/target", false)
+		Expect(condition.GetAbnormal()).To(BeTrue())
+		Expect(condition.GetMessage()).To(ContainSubstring("has disappeared"))
+	})
+
+	It("should report a filesystem that was remounted read only", func() {
+		writeMountInfo("100 50 8:32 / /target rw,relatime - ext4 /dev/sdc ro,errors=remount-ro")
+		condition := underTest.Condition("/target", false)
+		Expect(condition.GetAbnormal()).To(BeTrue())
+		Expect(condition.GetMessage()).To(ContainSubstring("remounted read only"))
+	})
+
+	It("should not report a filesystem that was published read only", func() {
+		writeMountInfo("100 50 8:32 / /target ro,relatime - ext4 /dev/sdc ro")
+		Expect(underTest.Condition("/target", false).GetAbnormal()).To(BeFalse())
+	})
+
+	It("should report a block volume whose device has disappeared", func() {
+		writeMountInfo("100 50 0:5 /sdc//deleted /target rw,nosuid - devtmpfs devtmpfs rw,size=4096k")
+		condition := underTest.Condition("/target", true)
+		Expect(condition.GetAbnormal()).To(BeTrue())
+		Expect(condition.GetMessage()).To(ContainSubstring("device /sdc of the volume has disappeared"))
+	})
+
+	It("should report errors the kernel logged for the device", func() {
+		writeMountInfo("100 50 0:5 /sdc /target rw,nosuid - devtmpfs devtmpfs rw,size=4096k")
+		writeKernelLog(devicesCreated+time.Minute,
+			"sd 0:0:0:2: [sdc] Attached SCSI disk",
+			"I/O error, dev sdc, sector 2048 op 0x1:(WRITE) flags 0x0 phys_seg 1 prio class 0",
+			"I/O error, dev sdcd, sector 2048 op 0x1:(WRITE) flags 0x0 phys_seg 1 prio class 0",
+		)
+		condition := underTest.Condition("/target", true)
+		Expect(condition.GetAbnormal()).To(BeTrue())
+		Expect(condition.GetMessage()).To(ContainSubstring("I/O error, dev sdc, sector 2048"))
+	})
+
+	It("should ignore errors logged before the device was created", func() {
+		writeMountInfo("100 50 8:32 / /target rw,relatime - xfs /dev/sdc rw")
+		writeKernelLog(devicesCreated-time.Minute,
+			"XFS (sdc): Corruption detected. Unmount and run xfs_repair",
+			"XFS (sdc): Filesystem has been shut down due to log error (0x2).",
+		)
+		Expect(underTest.Condition("/target", false).GetAbnormal()).To(BeFalse())
+	})
+
+	It("should ignore errors of an earlier LUKS mapping with the same name", func() {
+		Expect(os.WriteFile(filepath.Join(underTest.devDir, "dm-5"), nil, 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(underTest.devDir, "mapper"), 0755)).To(Succeed())
+		Expect(os.Symlink("../dm-5", filepath.Join(underTest.devDir, "mapper", "luks-pvc-123"))).To(Succeed())
+		writeMountInfo("100 50 253:5 / /target rw,relatime - ext4 /dev/mapper/luks-pvc-123 rw")
+		// dm-crypt logs nothing when a mapping is set up, only the creation of its device node tells them apart.
+		writeKernelLog(devicesCreated-time.Minute, "Buffer I/O error on dev dm-5, logical block 0, async page read")
+		Expect(underTest.Condition("/target", false).GetAbnormal()).To(BeFalse())
+
+		writeKernelLog(devicesCreated+time.Minute, "Buffer I/O error on dev dm-5, logical block 0, async page read")
+		condition := underTest.Condition("/target", false)
+		Expect(condition.GetAbnormal()).To(BeTrue())
+		Expect(condition.GetMessage()).To(ContainSubstring("kernel reported errors for device dm-5"))
+	})
+
+	It("should not mistake messages that mention errors for errors", func() {
+		writeMountInfo("100 50 8:32 / /target rw,relatime - ext4 /dev/sdc rw")
+		writeKernelLog(devicesCreated+time.Minute,
+			"EXT4-fs (sdc): mounted filesystem 6f1c2a4e-3b1d-4c59-9d6b-1f0e5b3a7c21 r/w with ordered data mode. Opts: errors=remount-ro. Quota mode: none.",
+		)
+		Expect(underTest.Condition("/target", false).GetAbnormal()).To(BeFalse())
+	})
+})
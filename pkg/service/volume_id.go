@@ -0,0 +1,66 @@
+package service
+
+import (
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/client-go/tools/cache"
+)
+
+// infraNamespaceParameter selects the infra cluster namespace the DataVolumes of a StorageClass are created in, so
+// they can be attached to the VMs of that namespace. It defaults to the infra cluster namespace of the driver.
+const infraNamespaceParameter = "infraNamespace"
+
+// infraObjectID returns the CSI ID of the volume or snapshot name in the infra namespace. Objects in the infra cluster
+// namespace are identified by their name alone, like before the driver supported other namespaces, objects in the
+// other allowed namespaces by namespace/name.
+func (c *ControllerService) infraObjectID(namespace, name string) string {
+	if namespace == "" || namespace == c.infraClusterNamespace {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// splitInfraObjectID returns the infra namespace and name of the volume or snapshot with the CSI ID id. It returns
+// InvalidArgument if the namespace is not an allowed infra cluster namespace.
+func (c *ControllerService) splitInfraObjectID(id string) (string, string, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(id)
+	if err != nil {
+		return "", "", status.Errorf(codes.InvalidArgument, "invalid ID %s: %v", id, err)
+	}
+	if namespace == "" {
+		namespace = c.infraClusterNamespace
+	}
+	if err := c.checkInfraNamespace(namespace); err != nil {
+		return "", "", err
+	}
+	return namespace, name, nil
+}
+
+// checkInfraNamespace returns InvalidArgument if namespace is neither the infra cluster namespace nor an allowed one.
+func (c *ControllerService) checkInfraNamespace(namespace string) error {
+	if namespace != c.infraClusterNamespace && !slices.Contains(c.allowedNamespaces, namespace) {
+		return status.Errorf(codes.InvalidArgument, "namespace %s is not an allowed infra cluster namespace", namespace)
+	}
+	return nil
+}
+
+// infraNamespaces returns the infra cluster namespace and the allowed namespaces.
+func (c *ControllerService) infraNamespaces() []string {
+	namespaces := []string{c.infraClusterNamespace}
+	for _, namespace := range c.allowedNamespaces {
+		if !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// volumeName returns the name part of a volume ID, the name of its DataVolume, which is the name of the
+// PersistentVolume in the tenant cluster. The node uses it where the volume ID has to be a valid name, for device
+// mapper names, state files and events.
+func volumeName(volumeID string) string {
+	return volumeID[strings.LastIndex(volumeID, "/")+1:]
+}
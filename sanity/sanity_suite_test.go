@@ -53,6 +53,15 @@ var _ = ginkgo.BeforeSuite(func() {
 	service.NewFsMaker = func() service.FsMaker {
 		return &fakeFsMaker{}
 	}
+	service.NewDeviceReleaser = func() service.DeviceReleaser {
+		return &fakeDeviceReleaser{}
+	}
+	service.NewDeviceSizer = func() service.DeviceSizer {
+		return &fakeDeviceSizer{}
+	}
+	service.NewVolumeStateStore = func() service.VolumeStateStore {
+		return &fakeStateStore{states: map[string]service.VolumeState{}}
+	}
 
 	storagClassEnforcement := util.StorageClassEnforcement{
 		AllowAll:     true,
@@ -68,9 +77,15 @@ var _ = ginkgo.BeforeSuite(func() {
 			infraClusterNamespace,
 			infraClusterLabelsMap,
 			storagClassEnforcement,
+			nil,
+			service.VMOwnership{},
+			service.ControllerTimeouts{},
+			0,
 		).
 		WithNodeService(
 			getKey(infraClusterNamespace, nodeID),
+			0,
+			nil,
 		)
 	gomega.Expect(err).ToNot(gomega.HaveOccurred())
 
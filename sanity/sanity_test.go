@@ -123,6 +123,9 @@ type fakeKubeVirtClient struct {
 func (k *fakeKubeVirtClient) Ping(ctx context.Context) error {
 	return nil
 }
+func (k *fakeKubeVirtClient) StartInformers(ctx context.Context, namespace string) error {
+	return nil
+}
 func (k *fakeKubeVirtClient) ListVirtualMachines(_ context.Context, namespace string) ([]kubevirtv1.VirtualMachineInstance, error) {
 	var res []kubevirtv1.VirtualMachineInstance
 	for _, v := range k.vmiMap {
@@ -133,11 +136,34 @@ func (k *fakeKubeVirtClient) ListVirtualMachines(_ context.Context, namespace st
 	return res, nil
 }
 
+func (k *fakeKubeVirtClient) ListVirtualMachinesWithVolume(ctx context.Context, namespace, volumeName string) ([]kubevirtv1.VirtualMachineInstance, error) {
+	vmis, err := k.ListVirtualMachines(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var res []kubevirtv1.VirtualMachineInstance
+	for _, vmi := range vmis {
+		for _, volumeStatus := range vmi.Status.VolumeStatus {
+			if volumeStatus.Name == volumeName {
+				res = append(res, vmi)
+			}
+		}
+	}
+	return res, nil
+}
+
 func (k *fakeKubeVirtClient) GetVirtualMachine(_ context.Context, namespace, vmName string) (*kubevirtv1.VirtualMachineInstance, error) {
 	vmKey := getKey(namespace, vmName)
+	if k.vmiMap[vmKey] == nil {
+		return nil, errors.NewNotFound(corev1.Resource("vmi"), vmName)
+	}
 	return k.vmiMap[vmKey], nil
 }
 
+func (k *fakeKubeVirtClient) GetActiveMigration(_ context.Context, namespace, vmiName string) (*kubevirtv1.VirtualMachineInstanceMigration, error) {
+	return nil, nil
+}
+
 func (k *fakeKubeVirtClient) GetWorkloadManagingVirtualMachine(_ context.Context, namespace, vmName string) (*kubevirtv1.VirtualMachine, error) {
 	vmKey := getKey(namespace, vmName)
 	if k.vmMap[vmKey] == nil {
@@ -201,6 +227,10 @@ func (k *fakeKubeVirtClient) RemoveVolumeFromVM(_ context.Context, namespace str
 	return nil
 }
 
+func (k *fakeKubeVirtClient) AddVolumeToVMI(ctx context.Context, namespace string, vmiName string, hotPlugRequest *kubevirtv1.AddVolumeOptions) error {
+	return k.AddVolumeToVM(ctx, namespace, vmiName, hotPlugRequest)
+}
+
 func (k *fakeKubeVirtClient) RemoveVolumeFromVMI(_ context.Context, namespace string, vmName string, hotPlugRequest *kubevirtv1.RemoveVolumeOptions) error {
 	return nil
 }
@@ -296,6 +326,54 @@ func (f *fakeDeviceLister) List() ([]byte, error) {
 	return json.Marshal(d)
 }
 
+type fakeDeviceReleaser struct{}
+
+func (r *fakeDeviceReleaser) Holders(devicePath string) ([]string, error) {
+	return nil, nil
+}
+
+func (r *fakeDeviceReleaser) Flush(devicePath string) error {
+	return nil
+}
+
+// fakeDeviceSizer reports every disk bigger than the volumes the sanity tests create and expand.
+type fakeDeviceSizer struct{}
+
+func (s *fakeDeviceSizer) Rescan(devicePath string) error {
+	return nil
+}
+
+func (s *fakeDeviceSizer) Size(devicePath string) (int64, error) {
+	return 100 * 1024 * 1024 * 1024, nil
+}
+
+type fakeStateStore struct {
+	states map[string]service.VolumeState
+}
+
+func (s *fakeStateStore) Save(state service.VolumeState) error {
+	s.states[state.VolumeID] = state
+	return nil
+}
+
+func (s *fakeStateStore) Get(volumeID string) (service.VolumeState, bool, error) {
+	state, found := s.states[volumeID]
+	return state, found, nil
+}
+
+func (s *fakeStateStore) Delete(volumeID string) error {
+	delete(s.states, volumeID)
+	return nil
+}
+
+func (s *fakeStateStore) List() ([]service.VolumeState, error) {
+	var states []service.VolumeState
+	for _, state := range s.states {
+		states = append(states, state)
+	}
+	return states, nil
+}
+
 func getKey(namespace, name string) string {
 	return fmt.Sprintf("%s/%s", namespace, name)
 }
@@ -351,8 +429,15 @@ func (m *fakeMounter) Unmount(target string) error {
 func (m *fakeMounter) List() ([]mount.MountPoint, error) {
 	res := make([]mount.MountPoint, 0)
 	for _, args := range *m.values {
+		// Like the kernel, report the device of a bind mount of another mount.
+		device := args.source
+		for _, other := range *m.values {
+			if other.target == args.source {
+				device = other.source
+			}
+		}
 		res = append(res, mount.MountPoint{
-			Device: args.source,
+			Device: device,
 			Path:   args.target,
 			Type:   args.fstype,
 		})
@@ -361,7 +446,8 @@ func (m *fakeMounter) List() ([]mount.MountPoint, error) {
 }
 
 func (m *fakeMounter) IsLikelyNotMountPoint(file string) (bool, error) {
-	return true, nil
+	mounted, err := m.PathExists(file)
+	return !mounted, err
 }
 
 func (m *fakeMounter) GetMountRefs(pathname string) ([]string, error) {
@@ -388,6 +474,10 @@ func (m *fakeMounter) IsBlockDevice(fullPath string) (bool, error) {
 	return false, nil
 }
 
+func (m *fakeMounter) BindRemount(target string, options []string) error {
+	return nil
+}
+
 func (m *fakeMounter) GetBlockSizeBytes(devicePath string) (int64, error) {
 	return 0, nil
 }
@@ -415,7 +505,7 @@ func (m *fakeMounter) PathExists(path string) (bool, error) {
 
 type fakeFsMaker struct{}
 
-func (fm *fakeFsMaker) Make(device string, fsType string) error {
+func (fm *fakeFsMaker) Make(device string, fsType string, options []string) error {
 	return nil
 }
 